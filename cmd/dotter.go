@@ -4,6 +4,7 @@ import (
 	"fmt"
 	"os"
 	"path/filepath"
+	"sort"
 	"strings"
 
 	"gopkg.in/alecthomas/kingpin.v2"
@@ -19,14 +20,45 @@ var (
 		"Installs a collection of dotfiles into a directory.",
 	)
 
-	sourcePath = app.Arg(
-		"source",
-		"Path to the dotfile collection to install.",
-	).String()
+	installCommand = app.Command(
+		"install",
+		"Installs the dotfiles into the target directory.",
+	).Default()
+	installPaths = newPathArgs(installCommand)
 
-	targetPath = app.Arg(
-		"target",
-		"Path to install the dotfiles to.",
+	statusCommand = app.Command(
+		"status",
+		"Reports where the target directory has drifted from the configuration.",
+	)
+	statusPaths = newPathArgs(statusCommand)
+
+	uninstallCommand = app.Command(
+		"uninstall",
+		"Removes the links installed into the target directory.",
+	)
+	uninstallPaths             = newPathArgs(uninstallCommand)
+	uninstallRemoveDirectories = uninstallCommand.Flag(
+		"remove-directories",
+		"Also remove configured directories that are now empty.",
+	).Short('d').Bool()
+
+	runCommand = app.Command(
+		"run",
+		"Runs the named step and the steps it depends on.",
+	)
+	runName = runCommand.Arg(
+		"name",
+		"Name of the step to run.",
+	).Required().String()
+	runPaths = newPathArgs(runCommand)
+
+	tagsCommand = app.Command(
+		"tags",
+		"Lists the tags and profiles defined by the configuration.",
+	)
+	tagsSource = tagsCommand.Arg(
+		"source",
+		"Path to the dotfile collection.",
 	).String()
 
 	quiet = app.Flag(
@@ -38,8 +70,66 @@ var (
 		"continue-on-error",
 		"Continue execution even if a step fails.",
 	).Short('c').Bool()
+
+	dryRun = app.Flag(
+		"dry-run",
+		"Show what each step would do without changing anything.",
+	).Short('n').Bool()
+
+	backupForced = app.Flag(
+		"backup",
+		"Move files replaced by forced steps into this directory (relative to the current directory).",
+	).Short('b').String()
+
+	tags = app.Flag(
+		"tags",
+		"Only run steps with these tags (comma-separated or repeated).",
+	).Short('t').Strings()
+
+	skipTags = app.Flag(
+		"skip-tags",
+		"Do not run steps with these tags (comma-separated or repeated).",
+	).Strings()
+
+	variables = app.Flag(
+		"var",
+		"Set a variable for use in the configuration (key=value, repeatable).",
+	).Short('v').StringMap()
+
+	jobs = app.Flag(
+		"jobs",
+		"Run up to this many steps marked parallel at the same time.",
+	).Short('j').Int()
+
+	output = app.Flag(
+		"output",
+		"The format of the output (text or json).",
+	).Short('o').Default("text").Enum("text", "json")
+
+	profile = app.Flag(
+		"profile",
+		"Only run steps with the tags selected by this profile.",
+	).Short('p').String()
 )
 
+type pathArgs struct {
+	source *string
+	target *string
+}
+
+func newPathArgs(cmd *kingpin.CmdClause) pathArgs {
+	return pathArgs{
+		source: cmd.Arg(
+			"source",
+			"Path to the dotfile collection to install.",
+		).String(),
+		target: cmd.Arg(
+			"target",
+			"Path to install the dotfiles to.",
+		).String(),
+	}
+}
+
 func cleanPath(path string) (string, error) {
 	if strings.HasPrefix(path, "~") {
 		home, err := os.UserHomeDir()
@@ -122,24 +212,126 @@ func failIfError(err error, message string) {
 	}
 }
 
-func main() {
-	app.Version(version)
-	app.HelpFlag.Short('h')
-	kingpin.MustParse(app.Parse(os.Args[1:]))
+func splitList(values []string) []string {
+	split := make([]string, 0, len(values))
+	for _, value := range values {
+		for _, part := range strings.Split(value, ",") {
+			part = strings.TrimSpace(part)
+			if part != "" {
+				split = append(split, part)
+			}
+		}
+	}
+	return split
+}
 
-	sourcePath, configPath, err := determineSource(*sourcePath)
+func loadConfiguration(source string) (string, dotter.Configuration) {
+	sourcePath, configPath, err := determineSource(source)
 	failIfError(err, "Could not determine source path")
-	targetPath, err := determineTarget(*targetPath)
-	failIfError(err, "Could not determine target path")
 
-	config, err := dotter.NewConfigurationFromFile(configPath)
+	config, err := dotter.NewConfigurationFromFileWithVariables(configPath, *variables)
 	failIfError(err, "Could not read configuration file")
+
+	return sourcePath, config
+}
+
+func newExecutor(paths pathArgs) dotter.Executor {
+	sourcePath, config := loadConfiguration(*paths.source)
+	targetPath, err := determineTarget(*paths.target)
+	failIfError(err, "Could not determine target path")
+
 	config.Options.Quiet = *quiet
 	config.Options.StopOnError = !*continueOnError
+	config.Options.DryRun = *dryRun
+	if *backupForced != "" {
+		// Unlike the backupforced option in the configuration, which is
+		// relative to the target, the flag is relative to where it was typed
+		config.Options.BackupForced, err = cleanPath(*backupForced)
+		failIfError(err, "Could not determine backup path")
+	}
+	if *jobs > 0 {
+		config.Options.Jobs = *jobs
+	}
+	if len(*tags) > 0 {
+		config.Options.Tags = splitList(*tags)
+	}
+	if len(*skipTags) > 0 {
+		config.Options.SkipTags = splitList(*skipTags)
+	}
+	if *profile != "" {
+		profileTags, err := config.GetProfileTags(*profile)
+		failIfError(err, "Could not select profile")
+		config.Options.Tags = append(config.Options.Tags, profileTags...)
+	}
 
 	exec := dotter.NewExecutor(sourcePath, targetPath, config)
-	err = exec.Execute()
-	if err != nil {
-		os.Exit(1)
+	if *output == "json" {
+		exec.Reporter = dotter.NewJSONReporter(os.Stdout)
+	}
+
+	return exec
+}
+
+func printTags(config dotter.Configuration) {
+	fmt.Println("Tags:")
+	for _, tag := range config.GetTags() {
+		fmt.Printf("  %s\n", tag)
+	}
+
+	profiles := make([]string, 0, len(config.Profiles))
+	for name := range config.Profiles {
+		profiles = append(profiles, name)
+	}
+	sort.Strings(profiles)
+
+	fmt.Println("Profiles:")
+	for _, name := range profiles {
+		fmt.Printf("  %s: %s\n", name, strings.Join(config.Profiles[name], ", "))
+	}
+}
+
+func main() {
+	app.Version(version)
+	app.HelpFlag.Short('h')
+	command := kingpin.MustParse(app.Parse(os.Args[1:]))
+
+	switch command {
+	case installCommand.FullCommand():
+		exec := newExecutor(installPaths)
+		err := exec.Execute()
+		if err != nil {
+			os.Exit(1)
+		}
+
+	case runCommand.FullCommand():
+		exec := newExecutor(runPaths)
+		steps, err := exec.Configuration.GetStepsFor(*runName)
+		failIfError(err, "Could not select step")
+		exec.Configuration.Steps = steps
+		err = exec.Execute()
+		if err != nil {
+			os.Exit(1)
+		}
+
+	case uninstallCommand.FullCommand():
+		if *dryRun {
+			app.Fatalf("--dry-run is not supported by uninstall, use status to see what is installed")
+		}
+		exec := newExecutor(uninstallPaths)
+		exec.Configuration.Options.RemoveDirectories = *uninstallRemoveDirectories
+		err := exec.Uninstall()
+		if err != nil {
+			os.Exit(1)
+		}
+
+	case statusCommand.FullCommand():
+		exec := newExecutor(statusPaths)
+		if exec.Status() > 0 {
+			os.Exit(1)
+		}
+
+	case tagsCommand.FullCommand():
+		_, config := loadConfiguration(*tagsSource)
+		printTags(config)
 	}
 }
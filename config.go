@@ -4,6 +4,9 @@ import (
 	"fmt"
 	"io/ioutil"
 	"os"
+	"path/filepath"
+	"sort"
+	"strings"
 
 	yaml "gopkg.in/yaml.v3"
 
@@ -11,10 +14,16 @@ import (
 )
 
 type StepDefaultOptions struct {
-	Link      step.LinkOptions
-	Directory step.DirectoryOptions
-	Shell     step.ShellOptions
-	Clean     step.CleanOptions
+	Link        step.LinkOptions
+	Directory   step.DirectoryOptions
+	Shell       step.ShellOptions
+	Clean       step.CleanOptions
+	Template    step.TemplateOptions
+	Copy        step.CopyOptions
+	Git         step.GitOptions
+	Extract     step.ExtractOptions
+	LineInFile  step.LineInFileOptions
+	BlockInFile step.BlockInFileOptions
 }
 
 func NewStepDefaultOptions() StepDefaultOptions {
@@ -23,14 +32,26 @@ func NewStepDefaultOptions() StepDefaultOptions {
 	opt.Directory = step.NewDirectoryOptions()
 	opt.Shell = step.NewShellOptions()
 	opt.Clean = step.NewCleanOptions()
+	opt.Template = step.NewTemplateOptions()
+	opt.Copy = step.NewCopyOptions()
+	opt.Git = step.NewGitOptions()
+	opt.Extract = step.NewExtractOptions()
+	opt.LineInFile = step.NewLineInFileOptions()
+	opt.BlockInFile = step.NewBlockInFileOptions()
 	return opt
 }
 
 type Options struct {
-	BackupForced string
-	StopOnError  bool
-	Quiet        bool
-	Defaults     StepDefaultOptions
+	BackupForced      string
+	StopOnError       bool
+	Quiet             bool
+	DryRun            bool   `yaml:"dry_run"`
+	RemoveDirectories bool   `yaml:"remove_directories"`
+	StateFile         string `yaml:"state_file"`
+	Tags              []string
+	SkipTags          []string `yaml:"skip_tags"`
+	Jobs              int
+	Defaults          StepDefaultOptions
 }
 
 func NewOptions() Options {
@@ -44,41 +65,83 @@ func NewOptions() Options {
 type Configuration struct {
 	SourcePath string
 	Options    Options
+	Profiles   map[string][]string
+	Variables  map[string]string
 	Steps      []step.Step
 }
 
 func NewConfiguration() Configuration {
 	cfg := Configuration{}
 	cfg.Options = NewOptions()
+	cfg.Profiles = make(map[string][]string)
+	cfg.Variables = make(map[string]string)
 	cfg.Steps = make([]step.Step, 0)
 	return cfg
 }
 
-func NewConfigurationFromFile(configPath string) (Configuration, error) {
-	file, err := os.Open(configPath)
-	if err != nil {
-		return NewConfiguration(), err
+// GetTags returns all of the tags used by the steps and profiles in the configuration
+func (cfg Configuration) GetTags() []string {
+	tags := step.StringList{}
+	for _, s := range cfg.Steps {
+		tags = tags.Union(s.GetMeta().Tags)
 	}
-	defer file.Close()
+	for _, profileTags := range cfg.Profiles {
+		tags = tags.Union(profileTags)
+	}
+	sort.Strings(tags)
+	return tags
+}
+
+// GetProfileTags returns the tags that the named profile selects
+func (cfg Configuration) GetProfileTags(profile string) ([]string, error) {
+	tags, ok := cfg.Profiles[profile]
+	if !ok {
+		return nil, fmt.Errorf("Unknown profile \"%s\"", profile)
+	}
+	return tags, nil
+}
+
+// GetStepsFor returns the steps with the specified name, along with
+// everything they depend on, in the order they should be run
+func (cfg Configuration) GetStepsFor(name string) ([]step.Step, error) {
+	return selectSteps(cfg.Steps, name)
+}
 
-	content, err := ioutil.ReadAll(file)
+func NewConfigurationFromFile(configPath string) (Configuration, error) {
+	return NewConfigurationFromFileWithVariables(configPath, nil)
+}
+
+// NewConfigurationFromFileWithVariables reads the configuration file, making
+// the specified variables available for interpolation into its steps
+func NewConfigurationFromFileWithVariables(configPath string, variables map[string]string) (Configuration, error) {
+	content, err := readConfigFile(configPath)
 	if err != nil {
 		return NewConfiguration(), err
 	}
 
-	cfg, err := NewConfigurationFromYaml(content)
-	cfg.SourcePath = configPath
-
-	return cfg, err
+	return newConfigurationFromYaml(content, configPath, variables)
 }
 
 type yamlConfig struct {
-	Options Options
-	Steps   []yaml.Node
+	Options   Options
+	Profiles  map[string]step.StringList
+	Variables yaml.Node
+	Steps     []yaml.Node
 }
 
 func NewConfigurationFromYaml(content []byte) (Configuration, error) {
+	return NewConfigurationFromYamlWithVariables(content, nil)
+}
+
+// NewConfigurationFromYamlWithVariables parses the configuration, making the
+// specified variables available for interpolation into its steps
+func NewConfigurationFromYamlWithVariables(content []byte, variables map[string]string) (Configuration, error) {
+	return newConfigurationFromYaml(content, "", variables)
+}
+
+func newConfigurationFromYaml(content []byte, sourcePath string, variables map[string]string) (Configuration, error) {
 	cfg := NewConfiguration()
+	cfg.SourcePath = sourcePath
 
 	tmpCfg := yamlConfig{}
 	tmpCfg.Options = NewOptions()
@@ -87,42 +150,290 @@ func NewConfigurationFromYaml(content []byte) (Configuration, error) {
 		return cfg, err
 	}
 	cfg.Options = tmpCfg.Options
+	for name, tags := range tmpCfg.Profiles {
+		cfg.Profiles[name] = tags
+	}
+
+	scope, defined, err := newVariableScope(tmpCfg.Variables, variables)
+	if err != nil {
+		return cfg, err
+	}
+	cfg.Variables = defined
+
+	parser := newStepParser(cfg.Options.Defaults)
+	parser.scope = scope
+	parser.variables = defined
+	if sourcePath != "" {
+		parser.sourceDir = filepath.Dir(sourcePath)
+		parser, err = parser.forFile(sourcePath)
+		if err != nil {
+			return cfg, err
+		}
+	}
+
+	steps, err := parser.parseSteps(tmpCfg.Steps)
+	if err != nil {
+		return cfg, err
+	}
+	cfg.Steps, err = orderSteps(steps)
+	if err != nil {
+		return cfg, err
+	}
+
+	return cfg, nil
+}
+
+func readConfigFile(configPath string) ([]byte, error) {
+	file, err := os.Open(configPath)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	return ioutil.ReadAll(file)
+}
+
+// stepParser builds Steps out of the nodes of a configuration file, keeping
+// track of where that file lives so that included files can be resolved.
+type stepParser struct {
+	defaults  StepDefaultOptions
+	meta      step.StepMeta
+	scope     map[string]string
+	variables map[string]string
+	sourceDir string
+	basePath  string
+	including []string
+}
+
+func newStepParser(defaults StepDefaultOptions) stepParser {
+	parser := stepParser{}
+	parser.defaults = defaults
+	parser.including = make([]string, 0)
+	parser.scope = make(map[string]string)
+	parser.variables = make(map[string]string)
+	return parser
+}
+
+// forFile returns a copy of the parser that resolves includes relative to the
+// specified configuration file, failing if that file is already being parsed.
+func (parser stepParser) forFile(configPath string) (stepParser, error) {
+	absPath, err := filepath.Abs(configPath)
+	if err != nil {
+		return parser, err
+	}
+
+	for idx, path := range parser.including {
+		if path == absPath {
+			cycle := append(parser.including[idx:], absPath)
+			return parser, fmt.Errorf("Include cycle detected: %s", strings.Join(cycle, " -> "))
+		}
+	}
 
-	for _, node := range tmpCfg.Steps {
+	child := parser
+	child.basePath = filepath.Dir(absPath)
+	child.including = make([]string, len(parser.including), len(parser.including)+1)
+	copy(child.including, parser.including)
+	child.including = append(child.including, absPath)
+	return child, nil
+}
+
+func (parser stepParser) parseSteps(nodes []yaml.Node) ([]step.Step, error) {
+	steps := make([]step.Step, 0)
+
+	for _, node := range nodes {
 		if node.Kind == yaml.MappingNode {
-			steps, err := parseStepsFromNode(node, cfg.Options.Defaults)
+			err := interpolateNode(&node, parser.scope)
 			if err != nil {
-				return cfg, err
+				return nil, err
 			}
-			cfg.Steps = append(cfg.Steps, steps...)
+			nodeSteps, err := parser.parseStepsFromNode(node)
+			if err != nil {
+				return nil, err
+			}
+			steps = append(steps, nodeSteps...)
 		} else {
-			return cfg, fmt.Errorf("Unexpected %s value at line %d", node.Tag, node.Line)
+			return nil, fmt.Errorf("Unexpected %s value at line %d", node.Tag, node.Line)
 		}
 	}
 
-	return cfg, nil
+	return steps, nil
+}
+
+// metaKeys are the keys that can appear next to the step type in a block to
+// set the StepMeta of all the steps in that block
+var metaKeys = map[string]bool{
+	"when":       true,
+	"only_if":    true,
+	"tags":       true,
+	"parallel":   true,
+	"name":       true,
+	"depends_on": true,
 }
 
-func parseStepsFromNode(node yaml.Node, defaults StepDefaultOptions) ([]step.Step, error) {
-	stepName := node.Content[0].Value
+func (parser stepParser) parseStepsFromNode(node yaml.Node) ([]step.Step, error) {
+	var stepName string
+	var stepLine int
+	var content *yaml.Node
+	metaNode := yaml.Node{Kind: yaml.MappingNode, Tag: "!!map", Line: node.Line}
+
+	for i := 0; i < len(node.Content); i += 2 {
+		key := node.Content[i]
+		if metaKeys[key.Value] {
+			metaNode.Content = append(metaNode.Content, key, node.Content[i+1])
+		} else if content == nil {
+			stepName = key.Value
+			stepLine = key.Line
+			content = node.Content[i+1]
+		} else {
+			return nil, fmt.Errorf(
+				"Multiple step types (\"%s\" and \"%s\") at line %d",
+				stepName,
+				key.Value,
+				key.Line,
+			)
+		}
+	}
+	if content == nil {
+		return nil, fmt.Errorf("No step type specified at line %d", node.Line)
+	}
+
+	meta := parser.meta
+	err := metaNode.Decode(&meta)
+	if err != nil {
+		return nil, err
+	}
+	defaults := parser.defaults
 
 	if stepName == "link" {
-		return parseLinkBlock(node.Content[1], defaults.Link)
+		return parseLinkBlock(content, defaults.Link, meta, parser.sourceDir)
 	} else if stepName == "directory" {
-		return parseDirectoryBlock(node.Content[1], defaults.Directory)
+		return parseDirectoryBlock(content, defaults.Directory, meta)
 	} else if stepName == "shell" {
-		return parseShellBlock(node.Content[1], defaults.Shell)
+		return parseShellBlock(content, defaults.Shell, meta)
 	} else if stepName == "clean" {
-		return parseCleanBlock(node.Content[1], defaults.Clean)
+		return parseCleanBlock(content, defaults.Clean, meta)
+	} else if stepName == "copy" {
+		return parseCopyBlock(content, defaults.Copy, meta)
+	} else if stepName == "git" {
+		return parseGitBlock(content, defaults.Git, meta)
+	} else if stepName == "extract" {
+		return parseExtractBlock(content, defaults.Extract, meta)
+	} else if stepName == "lineinfile" {
+		return parseLineInFileBlock(content, defaults.LineInFile, meta)
+	} else if stepName == "blockinfile" {
+		return parseBlockInFileBlock(content, defaults.BlockInFile, meta)
+	} else if stepName == "template" {
+		return parseTemplateBlock(content, defaults.Template, meta, parser.variables)
 	} else if stepName == "include_steps" {
-		// TODO
-		return nil, nil
+		child := parser
+		child.meta = meta
+		return child.parseIncludeBlock(content)
+	}
+
+	return nil, fmt.Errorf("Unexpected step type \"%s\" at line %d", stepName, stepLine)
+}
+
+func (parser stepParser) parseIncludeBlock(node *yaml.Node) ([]step.Step, error) {
+	paths := make([]*yaml.Node, 0)
+
+	if node.Tag == "!!str" {
+		paths = append(paths, node)
+	} else if node.Kind == yaml.SequenceNode {
+		for _, details := range node.Content {
+			if details.Tag != "!!str" {
+				return nil, fmt.Errorf("Unexpected include definition type %s at line %d", details.Tag, details.Line)
+			}
+			paths = append(paths, details)
+		}
+	} else {
+		return nil, fmt.Errorf("Unexpected include definition type %s at line %d", node.Tag, node.Line)
+	}
+
+	steps := make([]step.Step, 0)
+
+	for _, pathNode := range paths {
+		included, err := parser.includeFile(pathNode)
+		if err != nil {
+			return nil, err
+		}
+		steps = append(steps, included...)
+	}
+
+	return steps, nil
+}
+
+func (parser stepParser) includeFile(pathNode *yaml.Node) ([]step.Step, error) {
+	includePath := pathNode.Value
+	if !filepath.IsAbs(includePath) {
+		includePath = filepath.Join(parser.basePath, includePath)
+	}
+
+	child, err := parser.forFile(includePath)
+	if err != nil {
+		return nil, fmt.Errorf("Could not include %s at line %d: %w", pathNode.Value, pathNode.Line, err)
+	}
+
+	content, err := readConfigFile(includePath)
+	if err != nil {
+		return nil, fmt.Errorf("Could not include %s at line %d: %w", pathNode.Value, pathNode.Line, err)
+	}
+
+	return child.parseIncludedContent(includePath, content)
+}
+
+// yamlIncludedConfig is what is read from an included file; only its steps
+// are used, the other sections are kept as nodes to report that they are not
+type yamlIncludedConfig struct {
+	Options   yaml.Node
+	Profiles  yaml.Node
+	Variables yaml.Node
+	Steps     []yaml.Node
+}
+
+func (parser stepParser) parseIncludedContent(includePath string, content []byte) ([]step.Step, error) {
+	tmpCfg := yamlIncludedConfig{}
+	err := yaml.Unmarshal(content, &tmpCfg)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", includePath, err)
+	}
+	if tmpCfg.Options.Kind != 0 {
+		return nil, fmt.Errorf(
+			"%s: Options can only be set in the main configuration file, found at line %d",
+			includePath,
+			tmpCfg.Options.Line,
+		)
+	}
+	if tmpCfg.Profiles.Kind != 0 {
+		return nil, fmt.Errorf(
+			"%s: Profiles can only be defined in the main configuration file, found at line %d",
+			includePath,
+			tmpCfg.Profiles.Line,
+		)
+	}
+	if tmpCfg.Variables.Kind != 0 {
+		return nil, fmt.Errorf(
+			"%s: Variables can only be defined in the main configuration file, found at line %d",
+			includePath,
+			tmpCfg.Variables.Line,
+		)
+	}
+
+	steps, err := parser.parseSteps(tmpCfg.Steps)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", includePath, err)
 	}
 
-	return nil, fmt.Errorf("Unexpected step type \"%s\"", stepName)
+	return steps, nil
+}
+
+// linkExpansion contains the options of a link definition that turn it into
+// multiple LinkSteps
+type linkExpansion struct {
+	Exclude  step.StringList
+	Children bool
 }
 
-func parseLinkBlock(node *yaml.Node, defaults step.LinkOptions) ([]step.Step, error) {
+func parseLinkBlock(node *yaml.Node, defaults step.LinkOptions, meta step.StepMeta, sourceDir string) ([]step.Step, error) {
 	steps := make([]step.Step, 0)
 
 	if node.Kind != yaml.MappingNode {
@@ -132,7 +443,9 @@ func parseLinkBlock(node *yaml.Node, defaults step.LinkOptions) ([]step.Step, er
 
 	for i := 0; i < len(nodes); i += 2 {
 		link := step.NewLinkStepWithDefaults(defaults)
+		link.StepMeta = meta
 		link.Target = nodes[i].Value
+		expansion := linkExpansion{}
 
 		details := nodes[i+1]
 		if details.Tag == "!!str" {
@@ -143,18 +456,303 @@ func parseLinkBlock(node *yaml.Node, defaults step.LinkOptions) ([]step.Step, er
 			if err != nil {
 				return nil, err
 			}
+			link.Tags = meta.Tags.Union(link.Tags)
+			link.DependsOn = meta.DependsOn.Union(link.DependsOn)
+
+			err = details.Decode(&expansion)
+			if err != nil {
+				return nil, err
+			}
 
 		} else {
 			return nil, fmt.Errorf("Unexpected link definition type %s at line %d", details.Tag, details.Line)
 		}
 
-		steps = append(steps, link)
+		if expansion.Children || isGlob(link.Source) {
+			expanded, err := expandLink(link, expansion, sourceDir)
+			if err != nil {
+				return nil, fmt.Errorf("Could not expand link sources at line %d: %w", details.Line, err)
+			}
+			steps = append(steps, expanded...)
+		} else {
+			steps = append(steps, link)
+		}
+	}
+
+	return steps, nil
+}
+
+func isGlob(path string) bool {
+	return strings.ContainsAny(path, "*?[")
+}
+
+// expandLink creates a LinkStep for each source that matches the glob (or
+// each child of the source directory), linking them into the target as a
+// directory
+func expandLink(link step.LinkStep, expansion linkExpansion, sourceDir string) ([]step.Step, error) {
+	pattern := link.Source
+	if expansion.Children {
+		pattern = filepath.Join(pattern, "*")
+	}
+
+	matches, err := filepath.Glob(filepath.Join(sourceDir, pattern))
+	if err != nil {
+		return nil, err
+	}
+	if len(matches) == 0 {
+		return nil, fmt.Errorf("Nothing matches %s", pattern)
+	}
+
+	steps := make([]step.Step, 0, len(matches))
+	for _, match := range matches {
+		source, err := filepath.Rel(sourceDir, match)
+		if err != nil {
+			return nil, err
+		}
+
+		excluded := false
+		for _, exclude := range expansion.Exclude {
+			baseMatch, _ := filepath.Match(exclude, filepath.Base(source))
+			pathMatch, _ := filepath.Match(exclude, source)
+			if baseMatch || pathMatch {
+				excluded = true
+				break
+			}
+		}
+		if excluded {
+			continue
+		}
+
+		expanded := link
+		expanded.Source = source
+		expanded.Target = filepath.Join(link.Target, filepath.Base(source))
+		steps = append(steps, expanded)
+	}
+	if len(steps) == 0 {
+		return nil, fmt.Errorf("Everything matching %s is excluded", pattern)
+	}
+
+	return steps, nil
+}
+
+func parseCopyBlock(node *yaml.Node, defaults step.CopyOptions, meta step.StepMeta) ([]step.Step, error) {
+	steps := make([]step.Step, 0)
+
+	if node.Kind != yaml.MappingNode {
+		return nil, fmt.Errorf("Copy definitions not in a mapping at line %d", node.Line)
+	}
+	nodes := node.Content
+
+	for i := 0; i < len(nodes); i += 2 {
+		cp := step.NewCopyStepWithDefaults(defaults)
+		cp.StepMeta = meta
+		cp.Target = nodes[i].Value
+
+		details := nodes[i+1]
+		if details.Tag == "!!str" {
+			cp.Source = details.Value
+
+		} else if details.Kind == yaml.MappingNode {
+			err := details.Decode(&cp)
+			if err != nil {
+				return nil, err
+			}
+			cp.Tags = meta.Tags.Union(cp.Tags)
+			cp.DependsOn = meta.DependsOn.Union(cp.DependsOn)
+
+		} else {
+			return nil, fmt.Errorf("Unexpected copy definition type %s at line %d", details.Tag, details.Line)
+		}
+
+		steps = append(steps, cp)
+	}
+
+	return steps, nil
+}
+
+func parseGitBlock(node *yaml.Node, defaults step.GitOptions, meta step.StepMeta) ([]step.Step, error) {
+	steps := make([]step.Step, 0)
+
+	if node.Kind != yaml.MappingNode {
+		return nil, fmt.Errorf("Git definitions not in a mapping at line %d", node.Line)
+	}
+	nodes := node.Content
+
+	for i := 0; i < len(nodes); i += 2 {
+		repo := step.NewGitStepWithDefaults(defaults)
+		repo.StepMeta = meta
+		repo.Target = nodes[i].Value
+
+		details := nodes[i+1]
+		if details.Tag == "!!str" {
+			repo.URL = details.Value
+
+		} else if details.Kind == yaml.MappingNode {
+			err := details.Decode(&repo)
+			if err != nil {
+				return nil, err
+			}
+			repo.Tags = meta.Tags.Union(repo.Tags)
+			repo.DependsOn = meta.DependsOn.Union(repo.DependsOn)
+
+		} else {
+			return nil, fmt.Errorf("Unexpected git definition type %s at line %d", details.Tag, details.Line)
+		}
+
+		if repo.URL == "" {
+			return nil, fmt.Errorf("Git definition for %s has no url at line %d", repo.Target, details.Line)
+		}
+
+		steps = append(steps, repo)
+	}
+
+	return steps, nil
+}
+
+func parseExtractBlock(node *yaml.Node, defaults step.ExtractOptions, meta step.StepMeta) ([]step.Step, error) {
+	steps := make([]step.Step, 0)
+
+	if node.Kind != yaml.MappingNode {
+		return nil, fmt.Errorf("Extract definitions not in a mapping at line %d", node.Line)
+	}
+	nodes := node.Content
+
+	for i := 0; i < len(nodes); i += 2 {
+		ex := step.NewExtractStepWithDefaults(defaults)
+		ex.StepMeta = meta
+		ex.Target = nodes[i].Value
+
+		details := nodes[i+1]
+		if details.Tag == "!!str" {
+			ex.Source = details.Value
+
+		} else if details.Kind == yaml.MappingNode {
+			err := details.Decode(&ex)
+			if err != nil {
+				return nil, err
+			}
+			ex.Tags = meta.Tags.Union(ex.Tags)
+			ex.DependsOn = meta.DependsOn.Union(ex.DependsOn)
+
+		} else {
+			return nil, fmt.Errorf("Unexpected extract definition type %s at line %d", details.Tag, details.Line)
+		}
+
+		steps = append(steps, ex)
+	}
+
+	return steps, nil
+}
+
+func parseLineInFileBlock(node *yaml.Node, defaults step.LineInFileOptions, meta step.StepMeta) ([]step.Step, error) {
+	steps := make([]step.Step, 0)
+
+	if node.Kind != yaml.MappingNode {
+		return nil, fmt.Errorf("LineInFile definitions not in a mapping at line %d", node.Line)
+	}
+	nodes := node.Content
+
+	for i := 0; i < len(nodes); i += 2 {
+		edit := step.NewLineInFileStepWithDefaults(defaults)
+		edit.StepMeta = meta
+		edit.Target = nodes[i].Value
+
+		details := nodes[i+1]
+		if details.Tag == "!!str" {
+			edit.Line = details.Value
+
+		} else if details.Kind == yaml.MappingNode {
+			err := details.Decode(&edit)
+			if err != nil {
+				return nil, err
+			}
+			edit.Tags = meta.Tags.Union(edit.Tags)
+			edit.DependsOn = meta.DependsOn.Union(edit.DependsOn)
+
+		} else {
+			return nil, fmt.Errorf("Unexpected lineinfile definition type %s at line %d", details.Tag, details.Line)
+		}
+
+		steps = append(steps, edit)
+	}
+
+	return steps, nil
+}
+
+func parseBlockInFileBlock(node *yaml.Node, defaults step.BlockInFileOptions, meta step.StepMeta) ([]step.Step, error) {
+	steps := make([]step.Step, 0)
+
+	if node.Kind != yaml.MappingNode {
+		return nil, fmt.Errorf("BlockInFile definitions not in a mapping at line %d", node.Line)
+	}
+	nodes := node.Content
+
+	for i := 0; i < len(nodes); i += 2 {
+		edit := step.NewBlockInFileStepWithDefaults(defaults)
+		edit.StepMeta = meta
+		edit.Target = nodes[i].Value
+
+		details := nodes[i+1]
+		if details.Tag == "!!str" {
+			edit.Block = details.Value
+
+		} else if details.Kind == yaml.MappingNode {
+			err := details.Decode(&edit)
+			if err != nil {
+				return nil, err
+			}
+			edit.Tags = meta.Tags.Union(edit.Tags)
+			edit.DependsOn = meta.DependsOn.Union(edit.DependsOn)
+
+		} else {
+			return nil, fmt.Errorf("Unexpected blockinfile definition type %s at line %d", details.Tag, details.Line)
+		}
+
+		steps = append(steps, edit)
+	}
+
+	return steps, nil
+}
+
+func parseTemplateBlock(node *yaml.Node, defaults step.TemplateOptions, meta step.StepMeta, variables map[string]string) ([]step.Step, error) {
+	steps := make([]step.Step, 0)
+
+	if node.Kind != yaml.MappingNode {
+		return nil, fmt.Errorf("Template definitions not in a mapping at line %d", node.Line)
+	}
+	nodes := node.Content
+
+	for i := 0; i < len(nodes); i += 2 {
+		tmpl := step.NewTemplateStepWithDefaults(defaults)
+		tmpl.StepMeta = meta
+		for name, value := range variables {
+			tmpl.Variables[name] = value
+		}
+		tmpl.Target = nodes[i].Value
+
+		details := nodes[i+1]
+		if details.Tag == "!!str" {
+			tmpl.Source = details.Value
+
+		} else if details.Kind == yaml.MappingNode {
+			err := details.Decode(&tmpl)
+			if err != nil {
+				return nil, err
+			}
+			tmpl.Tags = meta.Tags.Union(tmpl.Tags)
+			tmpl.DependsOn = meta.DependsOn.Union(tmpl.DependsOn)
+
+		} else {
+			return nil, fmt.Errorf("Unexpected template definition type %s at line %d", details.Tag, details.Line)
+		}
+
+		steps = append(steps, tmpl)
 	}
 
 	return steps, nil
 }
 
-func parseDirectoryBlock(node *yaml.Node, defaults step.DirectoryOptions) ([]step.Step, error) {
+func parseDirectoryBlock(node *yaml.Node, defaults step.DirectoryOptions, meta step.StepMeta) ([]step.Step, error) {
 	steps := make([]step.Step, 0)
 
 	if node.Kind != yaml.SequenceNode {
@@ -163,6 +761,7 @@ func parseDirectoryBlock(node *yaml.Node, defaults step.DirectoryOptions) ([]ste
 
 	for _, details := range node.Content {
 		dir := step.NewDirectoryStepWithDefaults(defaults)
+		dir.StepMeta = meta
 
 		if details.Tag == "!!str" {
 			dir.Target = details.Value
@@ -172,6 +771,8 @@ func parseDirectoryBlock(node *yaml.Node, defaults step.DirectoryOptions) ([]ste
 			if err != nil {
 				return nil, err
 			}
+			dir.Tags = meta.Tags.Union(dir.Tags)
+			dir.DependsOn = meta.DependsOn.Union(dir.DependsOn)
 
 		} else {
 			return nil, fmt.Errorf("Unexpected directory definition type %s at line %d", details.Tag, details.Line)
@@ -183,7 +784,7 @@ func parseDirectoryBlock(node *yaml.Node, defaults step.DirectoryOptions) ([]ste
 	return steps, nil
 }
 
-func parseShellBlock(node *yaml.Node, defaults step.ShellOptions) ([]step.Step, error) {
+func parseShellBlock(node *yaml.Node, defaults step.ShellOptions, meta step.StepMeta) ([]step.Step, error) {
 	steps := make([]step.Step, 0)
 
 	if node.Kind != yaml.SequenceNode {
@@ -192,6 +793,7 @@ func parseShellBlock(node *yaml.Node, defaults step.ShellOptions) ([]step.Step,
 
 	for _, details := range node.Content {
 		shell := step.NewShellStepWithDefaults(defaults)
+		shell.StepMeta = meta
 
 		if details.Tag == "!!str" {
 			shell.Command = details.Value
@@ -201,6 +803,8 @@ func parseShellBlock(node *yaml.Node, defaults step.ShellOptions) ([]step.Step,
 			if err != nil {
 				return nil, err
 			}
+			shell.Tags = meta.Tags.Union(shell.Tags)
+			shell.DependsOn = meta.DependsOn.Union(shell.DependsOn)
 
 		} else {
 			return nil, fmt.Errorf("Unexpected shell definition type %s at line %d", details.Tag, details.Line)
@@ -212,7 +816,7 @@ func parseShellBlock(node *yaml.Node, defaults step.ShellOptions) ([]step.Step,
 	return steps, nil
 }
 
-func parseCleanBlock(node *yaml.Node, defaults step.CleanOptions) ([]step.Step, error) {
+func parseCleanBlock(node *yaml.Node, defaults step.CleanOptions, meta step.StepMeta) ([]step.Step, error) {
 	steps := make([]step.Step, 0)
 
 	if node.Kind != yaml.SequenceNode {
@@ -221,6 +825,7 @@ func parseCleanBlock(node *yaml.Node, defaults step.CleanOptions) ([]step.Step,
 
 	for _, details := range node.Content {
 		clean := step.NewCleanStepWithDefaults(defaults)
+		clean.StepMeta = meta
 
 		if details.Tag == "!!str" {
 			clean.Target = details.Value
@@ -230,6 +835,8 @@ func parseCleanBlock(node *yaml.Node, defaults step.CleanOptions) ([]step.Step,
 			if err != nil {
 				return nil, err
 			}
+			clean.Tags = meta.Tags.Union(clean.Tags)
+			clean.DependsOn = meta.DependsOn.Union(clean.DependsOn)
 
 		} else {
 			return nil, fmt.Errorf("Unexpected clean definition type %s at line %d", details.Tag, details.Line)
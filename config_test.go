@@ -1,12 +1,16 @@
 package dotter_test
 
 import (
+	"os"
 	"path/filepath"
+	"runtime"
+	"time"
 
 	. "github.com/onsi/ginkgo"
 	. "github.com/onsi/gomega"
 
 	"github.com/jayclassless/dotter"
+	"github.com/jayclassless/dotter/step"
 )
 
 var _ = Describe("Config", func() {
@@ -43,9 +47,656 @@ var _ = Describe("Config", func() {
 			_, err := dotter.NewConfigurationFromFile(filepath.Join(tmpDir, "doesntexist.yaml"))
 			Expect(err).Should(HaveOccurred())
 		})
+
+		It("Includes steps from other files", func() {
+			mkdir(tmpDir, "git")
+			writeFile(tmpDir, "dotter.yaml", `
+steps:
+  - directory:
+    - first
+  - include_steps: git/git.yaml
+  - directory:
+    - last
+`)
+			writeFile(tmpDir, "git/git.yaml", `
+steps:
+  - link:
+      .gitconfig: gitconfig
+  - include_steps:
+    - ../zsh.yaml
+`)
+			writeFile(tmpDir, "zsh.yaml", `
+steps:
+  - link:
+      .zshrc: zshrc
+`)
+			cfg, err := dotter.NewConfigurationFromFile(filepath.Join(tmpDir, "dotter.yaml"))
+			Expect(err).Should(Succeed())
+			Expect(cfg.Steps).To(HaveLen(4))
+			Expect(cfg.Steps[0].GetActivityDetails()).To(Equal("first"))
+			Expect(cfg.Steps[1].(step.LinkStep).Source).To(Equal("gitconfig"))
+			Expect(cfg.Steps[2].(step.LinkStep).Source).To(Equal("zshrc"))
+			Expect(cfg.Steps[3].GetActivityDetails()).To(Equal("last"))
+		})
+
+		It("Applies defaults to included steps", func() {
+			writeFile(tmpDir, "dotter.yaml", `
+options:
+  defaults:
+    link:
+      relative: false
+steps:
+  - include_steps: links.yaml
+`)
+			writeFile(tmpDir, "links.yaml", `
+steps:
+  - link:
+      .zshrc: zshrc
+`)
+			cfg, err := dotter.NewConfigurationFromFile(filepath.Join(tmpDir, "dotter.yaml"))
+			Expect(err).Should(Succeed())
+			Expect(cfg.Steps).To(HaveLen(1))
+			Expect(cfg.Steps[0].(step.LinkStep).Relative).To(BeFalse())
+		})
+
+		It("Fails on missing includes", func() {
+			writeFile(tmpDir, "dotter.yaml", `
+steps:
+  - include_steps: missing.yaml
+`)
+			_, err := dotter.NewConfigurationFromFile(filepath.Join(tmpDir, "dotter.yaml"))
+			Expect(err).Should(HaveOccurred())
+			Expect(err.Error()).To(ContainSubstring("missing.yaml at line 3"))
+		})
+
+		It("Fails on include cycles", func() {
+			writeFile(tmpDir, "dotter.yaml", `
+steps:
+  - include_steps: a.yaml
+`)
+			writeFile(tmpDir, "a.yaml", `
+steps:
+  - include_steps: b.yaml
+`)
+			writeFile(tmpDir, "b.yaml", `
+steps:
+  - include_steps: dotter.yaml
+`)
+			_, err := dotter.NewConfigurationFromFile(filepath.Join(tmpDir, "dotter.yaml"))
+			Expect(err).Should(HaveOccurred())
+			Expect(err.Error()).To(ContainSubstring("Include cycle detected"))
+		})
+
+		Describe("Link expansion", func() {
+			BeforeEach(func() {
+				mkdir(tmpDir, "bin")
+				writeFile(tmpDir, "bin/foo", "foo")
+				writeFile(tmpDir, "bin/bar", "bar")
+				writeFile(tmpDir, "bin/baz.bak", "baz")
+				mkdir(tmpDir, "config", "nvim")
+				writeFile(tmpDir, "config/starship.toml", "")
+			})
+
+			links := func(cfg dotter.Configuration) map[string]string {
+				found := make(map[string]string)
+				for _, s := range cfg.Steps {
+					link := s.(step.LinkStep)
+					found[link.Target] = link.Source
+				}
+				return found
+			}
+
+			It("Expands globs", func() {
+				writeFile(tmpDir, "dotter.yaml", `
+steps:
+  - link:
+      .local/bin/: bin/*
+`)
+				cfg, err := dotter.NewConfigurationFromFile(filepath.Join(tmpDir, "dotter.yaml"))
+				Expect(err).Should(Succeed())
+				Expect(links(cfg)).To(Equal(map[string]string{
+					".local/bin/foo":     "bin/foo",
+					".local/bin/bar":     "bin/bar",
+					".local/bin/baz.bak": "bin/baz.bak",
+				}))
+			})
+
+			It("Excludes patterns and keeps options", func() {
+				writeFile(tmpDir, "dotter.yaml", `
+steps:
+  - link:
+      .local/bin:
+        source: bin/*
+        exclude: ["*.bak", bin/bar]
+        relative: false
+`)
+				cfg, err := dotter.NewConfigurationFromFile(filepath.Join(tmpDir, "dotter.yaml"))
+				Expect(err).Should(Succeed())
+				Expect(links(cfg)).To(Equal(map[string]string{
+					".local/bin/foo": "bin/foo",
+				}))
+				Expect(cfg.Steps[0].(step.LinkStep).Relative).To(BeFalse())
+			})
+
+			It("Links the children of directories", func() {
+				writeFile(tmpDir, "dotter.yaml", `
+steps:
+  - link:
+      .config:
+        source: config
+        children: true
+`)
+				cfg, err := dotter.NewConfigurationFromFile(filepath.Join(tmpDir, "dotter.yaml"))
+				Expect(err).Should(Succeed())
+				Expect(links(cfg)).To(Equal(map[string]string{
+					".config/nvim":          "config/nvim",
+					".config/starship.toml": "config/starship.toml",
+				}))
+			})
+
+			It("Fails when nothing matches or everything is excluded", func() {
+				writeFile(tmpDir, "dotter.yaml", `
+steps:
+  - link:
+      .local/bin/: bni/*
+`)
+				_, err := dotter.NewConfigurationFromFile(filepath.Join(tmpDir, "dotter.yaml"))
+				Expect(err).To(MatchError(ContainSubstring("at line 4: Nothing matches bni/*")))
+
+				writeFile(tmpDir, "dotter.yaml", `
+steps:
+  - link:
+      .config:
+        source: cnofig
+        children: true
+`)
+				_, err = dotter.NewConfigurationFromFile(filepath.Join(tmpDir, "dotter.yaml"))
+				Expect(err).To(MatchError(ContainSubstring("Nothing matches cnofig/*")))
+
+				writeFile(tmpDir, "dotter.yaml", `
+steps:
+  - link:
+      .local/bin:
+        source: bin/*
+        exclude: ["*"]
+`)
+				_, err = dotter.NewConfigurationFromFile(filepath.Join(tmpDir, "dotter.yaml"))
+				Expect(err).To(MatchError(ContainSubstring("at line 5: Everything matching bin/* is excluded")))
+			})
+
+			It("Expands relative to the source directory from included files", func() {
+				mkdir(tmpDir, "sub")
+				writeFile(tmpDir, "sub/links.yaml", `
+steps:
+  - link:
+      bin: bin/f*
+`)
+				writeFile(tmpDir, "dotter.yaml", `
+steps:
+  - include_steps: sub/links.yaml
+`)
+				cfg, err := dotter.NewConfigurationFromFile(filepath.Join(tmpDir, "dotter.yaml"))
+				Expect(err).Should(Succeed())
+				Expect(links(cfg)).To(Equal(map[string]string{
+					"bin/foo": "bin/foo",
+				}))
+			})
+		})
+
+		It("Reports errors with the included file name", func() {
+			writeFile(tmpDir, "dotter.yaml", `
+steps:
+  - include_steps: bad.yaml
+`)
+			writeFile(tmpDir, "bad.yaml", `
+steps:
+  - bogus: []
+`)
+			_, err := dotter.NewConfigurationFromFile(filepath.Join(tmpDir, "dotter.yaml"))
+			Expect(err).Should(HaveOccurred())
+			Expect(err).To(MatchError(filepath.Join(tmpDir, "bad.yaml") + ": Unexpected step type \"bogus\" at line 3"))
+		})
+
+		It("Rejects options in included files", func() {
+			writeFile(tmpDir, "dotter.yaml", `
+steps:
+  - include_steps: git.yaml
+`)
+			writeFile(tmpDir, "git.yaml", `
+options:
+  stoponerror: false
+steps:
+  - directory:
+    - foo
+`)
+			_, err := dotter.NewConfigurationFromFile(filepath.Join(tmpDir, "dotter.yaml"))
+			Expect(err).To(MatchError(filepath.Join(tmpDir, "git.yaml") + ": Options can only be set in the main configuration file, found at line 3"))
+		})
+
+		It("Rejects variables in included files", func() {
+			writeFile(tmpDir, "dotter.yaml", `
+steps:
+  - include_steps: git.yaml
+`)
+			writeFile(tmpDir, "git.yaml", `
+variables:
+  email: me@example.com
+`)
+			_, err := dotter.NewConfigurationFromFile(filepath.Join(tmpDir, "dotter.yaml"))
+			Expect(err).To(MatchError(filepath.Join(tmpDir, "git.yaml") + ": Variables can only be defined in the main configuration file, found at line 3"))
+		})
+
+		It("Rejects profiles in included files", func() {
+			writeFile(tmpDir, "dotter.yaml", `
+steps:
+  - include_steps: git.yaml
+`)
+			writeFile(tmpDir, "git.yaml", `
+profiles:
+  work: [git]
+`)
+			_, err := dotter.NewConfigurationFromFile(filepath.Join(tmpDir, "dotter.yaml"))
+			Expect(err).To(MatchError(filepath.Join(tmpDir, "git.yaml") + ": Profiles can only be defined in the main configuration file, found at line 3"))
+		})
 	})
 
 	Describe("NewConfigurationFromYaml", func() {
+		It("Parses template steps", func() {
+			cfg, err := dotter.NewConfigurationFromYaml([]byte(`
+options:
+  defaults:
+    template:
+      mode: 0o600
+steps:
+  - template:
+      .npmrc: npmrc.tmpl
+      .gitconfig:
+        source: gitconfig.tmpl
+        mode: 0o644
+        variables:
+          email: me@example.com
+`))
+			Expect(err).Should(Succeed())
+			Expect(cfg.Steps).To(HaveLen(2))
+
+			npmrc := cfg.Steps[0].(step.TemplateStep)
+			Expect(npmrc.Target).To(Equal(".npmrc"))
+			Expect(npmrc.Source).To(Equal("npmrc.tmpl"))
+			Expect(npmrc.Mode).To(Equal(uint(0o600)))
+
+			gitconfig := cfg.Steps[1].(step.TemplateStep)
+			Expect(gitconfig.Source).To(Equal("gitconfig.tmpl"))
+			Expect(gitconfig.Mode).To(Equal(uint(0o644)))
+			Expect(gitconfig.Variables).To(HaveKeyWithValue("email", "me@example.com"))
+		})
+
+		It("Parses copy steps", func() {
+			cfg, err := dotter.NewConfigurationFromYaml([]byte(`
+steps:
+  - copy:
+      .config/app: app
+      .npmrc:
+        source: npmrc
+        force: true
+`))
+			Expect(err).Should(Succeed())
+			Expect(cfg.Steps).To(HaveLen(2))
+			Expect(cfg.Steps[0].(step.CopyStep).Source).To(Equal("app"))
+			Expect(cfg.Steps[0].(step.CopyStep).Force).To(BeFalse())
+			Expect(cfg.Steps[1].(step.CopyStep).Force).To(BeTrue())
+		})
+
+		It("Parses git steps", func() {
+			cfg, err := dotter.NewConfigurationFromYaml([]byte(`
+options:
+  defaults:
+    git:
+      depth: 1
+steps:
+  - git:
+      .oh-my-zsh: https://github.com/ohmyzsh/ohmyzsh.git
+      .tmux/plugins/tpm:
+        url: https://github.com/tmux-plugins/tpm
+        ref: v3.1.0
+        update: never
+`))
+			Expect(err).Should(Succeed())
+			Expect(cfg.Steps).To(HaveLen(2))
+			Expect(cfg.Steps[0].(step.GitStep).URL).To(Equal("https://github.com/ohmyzsh/ohmyzsh.git"))
+			Expect(cfg.Steps[0].(step.GitStep).Depth).To(Equal(1))
+			Expect(cfg.Steps[0].(step.GitStep).Update).To(Equal("always"))
+			Expect(cfg.Steps[1].(step.GitStep).Target).To(Equal(".tmux/plugins/tpm"))
+			Expect(cfg.Steps[1].(step.GitStep).Ref).To(Equal("v3.1.0"))
+			Expect(cfg.Steps[1].(step.GitStep).Update).To(Equal("never"))
+
+			_, err = dotter.NewConfigurationFromYaml([]byte(`
+steps:
+  - git:
+      .vim/pack/plugins:
+        ref: main
+`))
+			Expect(err).To(MatchError("Git definition for .vim/pack/plugins has no url at line 5"))
+		})
 
+		It("Parses extract steps", func() {
+			cfg, err := dotter.NewConfigurationFromYaml([]byte(`
+steps:
+  - extract:
+      .local/share/fonts: fonts.zip
+      .local:
+        source: ripgrep.tar.gz
+        strip_components: 1
+        include: bin/*
+`))
+			Expect(err).Should(Succeed())
+			Expect(cfg.Steps).To(HaveLen(2))
+			Expect(cfg.Steps[0].(step.ExtractStep).Source).To(Equal("fonts.zip"))
+			Expect(cfg.Steps[0].(step.ExtractStep).StripComponents).To(Equal(0))
+			Expect(cfg.Steps[1].(step.ExtractStep).StripComponents).To(Equal(1))
+			Expect(cfg.Steps[1].(step.ExtractStep).Include).To(Equal(step.StringList{"bin/*"}))
+		})
+
+		It("Parses lineinfile and blockinfile steps", func() {
+			cfg, err := dotter.NewConfigurationFromYaml([]byte(`
+options:
+  defaults:
+    blockinfile:
+      marker: "# {mark} dotfiles"
+steps:
+  - lineinfile:
+      .profile: export EDITOR=vim
+      .bashrc:
+        regexp: ^set -o
+        line: set -o vi
+        insert_after: EOF
+        state: absent
+  - blockinfile:
+      .ssh/config: |
+        Host github.com
+          User git
+`))
+			Expect(err).Should(Succeed())
+			Expect(cfg.Steps).To(HaveLen(3))
+			Expect(cfg.Steps[0].(step.LineInFileStep).Line).To(Equal("export EDITOR=vim"))
+			Expect(cfg.Steps[0].(step.LineInFileStep).State).To(Equal("present"))
+			Expect(cfg.Steps[1].(step.LineInFileStep).Regexp).To(Equal("^set -o"))
+			Expect(cfg.Steps[1].(step.LineInFileStep).InsertAfter).To(Equal("EOF"))
+			Expect(cfg.Steps[1].(step.LineInFileStep).State).To(Equal("absent"))
+			Expect(cfg.Steps[2].(step.BlockInFileStep).Block).To(Equal("Host github.com\n  User git\n"))
+			Expect(cfg.Steps[2].(step.BlockInFileStep).Marker).To(Equal("# {mark} dotfiles"))
+		})
+
+		It("Parses conditions", func() {
+			cfg, err := dotter.NewConfigurationFromYaml([]byte(`
+steps:
+  - link:
+      .bashrc: bashrc
+      .zshrc:
+        source: zshrc
+        when:
+          command: zsh
+    when:
+      os: linux
+  - shell:
+    - command: brew bundle
+      when:
+        os: [darwin]
+`))
+			Expect(err).Should(Succeed())
+			Expect(cfg.Steps).To(HaveLen(3))
+			Expect(cfg.Steps[0].GetMeta().When.OS).To(Equal(step.StringList{"linux"}))
+			Expect(cfg.Steps[1].GetMeta().When.OS).To(Equal(step.StringList{"linux"}))
+			Expect(cfg.Steps[1].GetMeta().When.Command).To(Equal(step.StringList{"zsh"}))
+			Expect(cfg.Steps[2].GetMeta().When.OS).To(Equal(step.StringList{"darwin"}))
+		})
+
+		It("Parses only_if and rejects unknown conditions", func() {
+			cfg, err := dotter.NewConfigurationFromYaml([]byte(`
+steps:
+  - link:
+      .bashrc: bashrc
+    only_if: test -d /etc
+  - shell:
+    - command: brew bundle
+      only_if: command -v brew
+`))
+			Expect(err).Should(Succeed())
+			Expect(cfg.Steps[0].GetMeta().OnlyIf).To(Equal("test -d /etc"))
+			Expect(cfg.Steps[1].GetMeta().OnlyIf).To(Equal("command -v brew"))
+
+			_, err = dotter.NewConfigurationFromYaml([]byte(`
+steps:
+  - link:
+      .bashrc: bashrc
+    when:
+      hostnme: laptop
+`))
+			Expect(err).To(MatchError(ContainSubstring("Unknown condition \"hostnme\" at line 6")))
+		})
+
+		It("Parses tags and profiles", func() {
+			cfg, err := dotter.NewConfigurationFromYaml([]byte(`
+profiles:
+  work: [work, common]
+  minimal: common
+steps:
+  - link:
+      .bashrc: bashrc
+      .zshrc:
+        source: zshrc
+        tags: personal
+    tags: common
+  - directory:
+    - foo
+`))
+			Expect(err).Should(Succeed())
+			Expect(cfg.Steps[0].GetMeta().Tags).To(Equal(step.StringList{"common"}))
+			Expect(cfg.Steps[1].GetMeta().Tags).To(Equal(step.StringList{"common", "personal"}))
+			Expect(cfg.Steps[2].GetMeta().Tags).To(HaveLen(0))
+
+			Expect(cfg.GetTags()).To(Equal([]string{"common", "personal", "work"}))
+
+			tags, err := cfg.GetProfileTags("minimal")
+			Expect(err).Should(Succeed())
+			Expect(tags).To(Equal([]string{"common"}))
+
+			_, err = cfg.GetProfileTags("bogus")
+			Expect(err).Should(HaveOccurred())
+		})
+
+		It("Fails on multiple step types in a block", func() {
+			_, err := dotter.NewConfigurationFromYaml([]byte(`
+steps:
+  - link:
+      .bashrc: bashrc
+    directory:
+      - foo
+`))
+			Expect(err).Should(HaveOccurred())
+		})
+
+		It("Parses shell options", func() {
+			cfg, err := dotter.NewConfigurationFromYaml([]byte(`
+options:
+  defaults:
+    shell:
+      shell: bash
+      env:
+        FOO: foo
+steps:
+  - shell:
+    - command: one
+      env:
+        BAR: bar
+      cwd: sub
+      cwd_from: source
+      timeout: 30s
+      success_codes: [0, 1]
+      creates: .vim/plug
+      unless: test -d .vim
+    - two
+`))
+			Expect(err).Should(Succeed())
+
+			one := cfg.Steps[0].(step.ShellStep)
+			Expect(one.Shell).To(Equal("bash"))
+			Expect(one.Env).To(Equal(map[string]string{"FOO": "foo", "BAR": "bar"}))
+			Expect(one.Cwd).To(Equal("sub"))
+			Expect(one.CwdFrom).To(Equal("source"))
+			Expect(one.Timeout).To(Equal(30 * time.Second))
+			Expect(one.SuccessCodes).To(Equal([]int{0, 1}))
+			Expect(one.Creates).To(Equal(".vim/plug"))
+			Expect(one.Unless).To(Equal("test -d .vim"))
+
+			two := cfg.Steps[1].(step.ShellStep)
+			Expect(two.Shell).To(Equal("bash"))
+			Expect(two.Env).To(Equal(map[string]string{"FOO": "foo"}))
+			Expect(two.CwdFrom).To(Equal("target"))
+			Expect(two.SuccessCodes).To(Equal([]int{0}))
+		})
+
+		It("Parses parallel blocks", func() {
+			cfg, err := dotter.NewConfigurationFromYaml([]byte(`
+options:
+  jobs: 3
+steps:
+  - shell:
+    - foo
+    - bar
+    parallel: true
+  - shell:
+    - baz
+`))
+			Expect(err).Should(Succeed())
+			Expect(cfg.Options.Jobs).To(Equal(3))
+			Expect(*cfg.Steps[0].GetMeta().Parallel).To(BeTrue())
+			Expect(*cfg.Steps[1].GetMeta().Parallel).To(BeTrue())
+			Expect(cfg.Steps[2].GetMeta().Parallel).To(BeNil())
+		})
+
+		Describe("Variables", func() {
+			It("Expands variables in steps", func() {
+				os.Setenv("DOTTER_TEST", "fromenv")
+				defer os.Unsetenv("DOTTER_TEST")
+
+				cfg, err := dotter.NewConfigurationFromYamlWithVariables([]byte(`
+variables:
+  app: myapp
+  conf: .config/${app}
+steps:
+  - link:
+      "${conf}/{{ .name }}": "${DOTTER_TEST}/${os}"
+  - shell:
+    - echo $$HOME ${app}
+  - directory:
+    - ${home}
+`), map[string]string{"name": "fromcli"})
+				Expect(err).Should(Succeed())
+				Expect(cfg.Variables).To(Equal(map[string]string{
+					"app":  "myapp",
+					"conf": ".config/myapp",
+					"name": "fromcli",
+				}))
+
+				link := cfg.Steps[0].(step.LinkStep)
+				Expect(link.Target).To(Equal(".config/myapp/fromcli"))
+				Expect(link.Source).To(Equal("fromenv/" + runtime.GOOS))
+				Expect(cfg.Steps[1].(step.ShellStep).Command).To(Equal("echo $HOME myapp"))
+
+				home, _ := os.UserHomeDir()
+				Expect(cfg.Steps[2].(step.DirectoryStep).Target).To(Equal(home))
+			})
+
+			It("Expands and escapes commands and file contents like everything else", func() {
+				cfg, err := dotter.NewConfigurationFromYaml([]byte(`
+variables:
+  app: myapp
+steps:
+  - shell:
+    - docker inspect --format '{{ "{{" }}.Id}}' ${app}
+    - command: echo $$ $${i} {{ .app }}
+      unless: test -f ${app}
+    only_if: test -n "$${i}"
+  - lineinfile:
+      .profile: export PATH=$$HOME/bin:$${PATH}:${app}
+`))
+				Expect(err).Should(Succeed())
+				Expect(cfg.Steps[0].(step.ShellStep).Command).To(Equal("docker inspect --format '{{.Id}}' myapp"))
+				Expect(cfg.Steps[1].(step.ShellStep).Command).To(Equal("echo $ ${i} myapp"))
+				Expect(cfg.Steps[1].(step.ShellStep).Unless).To(Equal("test -f myapp"))
+				Expect(cfg.Steps[1].GetMeta().OnlyIf).To(Equal("test -n \"${i}\""))
+				Expect(cfg.Steps[2].(step.LineInFileStep).Line).To(Equal("export PATH=$HOME/bin:${PATH}:myapp"))
+			})
+
+			It("Lets explicit variables override the configuration", func() {
+				cfg, err := dotter.NewConfigurationFromYamlWithVariables([]byte(`
+variables:
+  app: myapp
+steps:
+  - directory:
+    - ${app}
+`), map[string]string{"app": "other"})
+				Expect(err).Should(Succeed())
+				Expect(cfg.Steps[0].(step.DirectoryStep).Target).To(Equal("other"))
+			})
+
+			It("Makes variables available to templates", func() {
+				cfg, err := dotter.NewConfigurationFromYaml([]byte(`
+variables:
+  email: me@example.com
+steps:
+  - template:
+      .gitconfig:
+        source: gitconfig
+        variables:
+          name: Me
+`))
+				Expect(err).Should(Succeed())
+				Expect(cfg.Steps[0].(step.TemplateStep).Variables).To(Equal(map[string]string{
+					"email": "me@example.com",
+					"name":  "Me",
+				}))
+			})
+
+			It("Fails on undefined variables", func() {
+				_, err := dotter.NewConfigurationFromYaml([]byte(`
+steps:
+  - directory:
+    - ${dotter_bogus}
+`))
+				Expect(err).Should(HaveOccurred())
+				Expect(err.Error()).To(Equal("Undefined variable \"dotter_bogus\" at line 4"))
+
+				_, err = dotter.NewConfigurationFromYaml([]byte(`
+steps:
+  - directory:
+    - "{{ .dotter_bogus }}"
+`))
+				Expect(err).Should(HaveOccurred())
+
+				_, err = dotter.NewConfigurationFromYaml([]byte(`
+steps:
+  - shell:
+    - echo ${dotter_bogus}
+`))
+				Expect(err).To(MatchError("Undefined variable \"dotter_bogus\" at line 4"))
+
+				_, err = dotter.NewConfigurationFromYaml([]byte(`
+steps:
+  - shell:
+    - echo {{ .dotter_bogus }}
+`))
+				Expect(err).To(MatchError(ContainSubstring("at line 4")))
+			})
+		})
+
+		It("Fails on bad template definitions", func() {
+			_, err := dotter.NewConfigurationFromYaml([]byte(`
+steps:
+  - template:
+    - foo
+`))
+			Expect(err).Should(HaveOccurred())
+		})
 	})
 })
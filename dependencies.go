@@ -0,0 +1,175 @@
+package dotter
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/jayclassless/dotter/step"
+)
+
+// dependencyGraph relates the steps of a configuration by their names and
+// depends_on lists
+type dependencyGraph struct {
+	steps []step.Step
+	named map[string][]int
+}
+
+func newDependencyGraph(steps []step.Step) (dependencyGraph, error) {
+	graph := dependencyGraph{
+		steps: steps,
+		named: make(map[string][]int),
+	}
+
+	for idx, s := range steps {
+		if name := s.GetMeta().Name; name != "" {
+			graph.named[name] = append(graph.named[name], idx)
+		}
+	}
+
+	for _, s := range steps {
+		for _, dependency := range s.GetMeta().DependsOn {
+			if _, ok := graph.named[dependency]; !ok {
+				return graph, fmt.Errorf(
+					"%s %s depends on unknown step \"%s\"",
+					s.GetActivityLabel(),
+					s.GetActivityDetails(),
+					dependency,
+				)
+			}
+		}
+	}
+
+	return graph, graph.checkCycles()
+}
+
+// prerequisites returns the indexes of the steps that the step at the
+// specified index depends on directly
+func (graph dependencyGraph) prerequisites(idx int) []int {
+	found := make([]int, 0)
+	for _, dependency := range graph.steps[idx].GetMeta().DependsOn {
+		found = append(found, graph.named[dependency]...)
+	}
+	return found
+}
+
+func (graph dependencyGraph) checkCycles() error {
+	const (
+		unvisited = iota
+		visiting
+		visited
+	)
+	states := make(map[string]int)
+	path := make([]string, 0)
+
+	var visit func(name string) error
+	visit = func(name string) error {
+		switch states[name] {
+		case visiting:
+			start := 0
+			for path[start] != name {
+				start++
+			}
+			cycle := append(append([]string{}, path[start:]...), name)
+			return fmt.Errorf("Dependency cycle detected: %s", strings.Join(cycle, " -> "))
+		case visited:
+			return nil
+		}
+
+		states[name] = visiting
+		path = append(path, name)
+		for _, idx := range graph.named[name] {
+			for _, dependency := range graph.steps[idx].GetMeta().DependsOn {
+				if err := visit(dependency); err != nil {
+					return err
+				}
+			}
+		}
+		path = path[:len(path)-1]
+		states[name] = visited
+
+		return nil
+	}
+
+	for _, s := range graph.steps {
+		if name := s.GetMeta().Name; name != "" {
+			if err := visit(name); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+// order returns the steps at the specified indexes so that every step comes
+// after the steps it depends on; otherwise the original order is kept
+func (graph dependencyGraph) order(include map[int]bool) []step.Step {
+	ordered := make([]step.Step, 0, len(include))
+	done := make(map[int]bool)
+
+	for len(done) < len(include) {
+		for idx := range graph.steps {
+			if !include[idx] || done[idx] {
+				continue
+			}
+
+			ready := true
+			for _, prerequisite := range graph.prerequisites(idx) {
+				if !done[prerequisite] {
+					ready = false
+					break
+				}
+			}
+			if ready {
+				ordered = append(ordered, graph.steps[idx])
+				done[idx] = true
+				break
+			}
+		}
+	}
+
+	return ordered
+}
+
+// orderSteps sorts the steps so that each runs after the steps it depends on
+func orderSteps(steps []step.Step) ([]step.Step, error) {
+	graph, err := newDependencyGraph(steps)
+	if err != nil {
+		return nil, err
+	}
+
+	include := make(map[int]bool)
+	for idx := range steps {
+		include[idx] = true
+	}
+
+	return graph.order(include), nil
+}
+
+// selectSteps returns the steps with the specified name and everything they
+// depend on, in the order they should be run
+func selectSteps(steps []step.Step, name string) ([]step.Step, error) {
+	graph, err := newDependencyGraph(steps)
+	if err != nil {
+		return nil, err
+	}
+
+	named, ok := graph.named[name]
+	if !ok {
+		return nil, fmt.Errorf("Unknown step \"%s\"", name)
+	}
+
+	include := make(map[int]bool)
+	pending := append([]int{}, named...)
+	for len(pending) > 0 {
+		idx := pending[0]
+		pending = pending[1:]
+		if include[idx] {
+			continue
+		}
+		include[idx] = true
+		pending = append(pending, graph.prerequisites(idx)...)
+	}
+
+	return graph.order(include), nil
+}
@@ -0,0 +1,118 @@
+package dotter_test
+
+import (
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	"github.com/jayclassless/dotter"
+	"github.com/jayclassless/dotter/step"
+)
+
+var _ = Describe("Dependencies", func() {
+	commands := func(steps []step.Step) []string {
+		found := make([]string, 0, len(steps))
+		for _, s := range steps {
+			found = append(found, s.(step.ShellStep).Command)
+		}
+		return found
+	}
+
+	It("Keeps the original order without dependencies", func() {
+		cfg, err := dotter.NewConfigurationFromYaml([]byte(`
+steps:
+  - shell:
+    - one
+    - two
+    name: first
+  - shell:
+    - three
+`))
+		Expect(err).Should(Succeed())
+		Expect(commands(cfg.Steps)).To(Equal([]string{"one", "two", "three"}))
+		Expect(cfg.Steps[0].GetMeta().Name).To(Equal("first"))
+	})
+
+	It("Runs steps after what they depend on", func() {
+		cfg, err := dotter.NewConfigurationFromYaml([]byte(`
+steps:
+  - shell:
+    - plugins
+    depends_on: [vim, tmux]
+  - shell:
+    - unrelated
+  - shell:
+    - command: tpm
+      name: tmux
+      depends_on: git
+  - shell:
+    - vim-plug
+    name: vim
+  - shell:
+    - clone
+    name: git
+`))
+		Expect(err).Should(Succeed())
+		Expect(commands(cfg.Steps)).To(Equal([]string{"unrelated", "vim-plug", "clone", "tpm", "plugins"}))
+	})
+
+	It("Rejects cycles", func() {
+		_, err := dotter.NewConfigurationFromYaml([]byte(`
+steps:
+  - shell:
+    - one
+    name: a
+    depends_on: c
+  - shell:
+    - two
+    name: b
+    depends_on: a
+  - shell:
+    - three
+    name: c
+    depends_on: b
+`))
+		Expect(err).To(MatchError("Dependency cycle detected: a -> c -> b -> a"))
+	})
+
+	It("Rejects unknown dependencies", func() {
+		_, err := dotter.NewConfigurationFromYaml([]byte(`
+steps:
+  - shell:
+    - one
+    depends_on: missing
+`))
+		Expect(err).To(MatchError("Executing one depends on unknown step \"missing\""))
+	})
+
+	Describe("GetStepsFor", func() {
+		var cfg dotter.Configuration
+
+		BeforeEach(func() {
+			var err error
+			cfg, err = dotter.NewConfigurationFromYaml([]byte(`
+steps:
+  - shell:
+    - clone
+    name: git
+  - shell:
+    - unrelated
+  - shell:
+    - tpm
+    name: tmux
+    depends_on: git
+`))
+			Expect(err).Should(Succeed())
+		})
+
+		It("Selects the step and its prerequisites", func() {
+			steps, err := cfg.GetStepsFor("tmux")
+			Expect(err).Should(Succeed())
+			Expect(commands(steps)).To(Equal([]string{"clone", "tpm"}))
+		})
+
+		It("Rejects unknown names", func() {
+			_, err := cfg.GetStepsFor("missing")
+			Expect(err).To(MatchError("Unknown step \"missing\""))
+		})
+	})
+})
@@ -2,26 +2,47 @@ package dotter
 
 import (
 	"fmt"
+	"io/ioutil"
 	"os"
 	"path/filepath"
+	"strconv"
 	"strings"
+	"sync"
+	"time"
 
-	"github.com/fatih/color"
+	"github.com/jayclassless/dotter/step"
 )
 
-var (
-	cYellow  = color.New(color.FgYellow).SprintFunc()
-	cbYellow = color.New(color.FgYellow, color.Bold).SprintFunc()
-	cGreen   = color.New(color.FgGreen).SprintFunc()
-	cbGreen  = color.New(color.FgGreen, color.Bold).SprintFunc()
-	cbRed    = color.New(color.FgRed, color.Bold).SprintFunc()
-	cbCyan   = color.New(color.FgCyan, color.Bold).SprintFunc()
-)
+const backupTimeFormat = "20060102T150405"
+
+// DefaultJobs is the number of steps marked parallel that run at the same time
+// when the number of jobs has not been specified
+const DefaultJobs = 4
+
+// AlwaysTag is the tag that marks steps to run regardless of which tags are selected
+const AlwaysTag = "always"
+
+// Summary counts the outcomes of the steps run by an Executor
+type Summary struct {
+	Changed   int `json:"changed"`
+	Unchanged int `json:"unchanged"`
+	Skipped   int `json:"skipped"`
+	Failed    int `json:"failed"`
+}
+
+func (summary *Summary) add(other Summary) {
+	summary.Changed += other.Changed
+	summary.Unchanged += other.Unchanged
+	summary.Skipped += other.Skipped
+	summary.Failed += other.Failed
+}
 
 type Executor struct {
 	SourceDirectory string
 	TargetDirectory string
 	Configuration   Configuration
+	State           *State
+	Reporter        Reporter
 }
 
 func NewExecutor(sourceDirectory string, targetDirectory string, config Configuration) Executor {
@@ -29,46 +50,515 @@ func NewExecutor(sourceDirectory string, targetDirectory string, config Configur
 	exec.SourceDirectory = sourceDirectory
 	exec.TargetDirectory = targetDirectory
 	exec.Configuration = config
+	exec.State = NewState(exec.GetStatePath())
+	exec.Reporter = NewTextReporter(os.Stdout)
 	return exec
 }
 
-func (exec Executor) output(format string, a ...interface{}) {
+// GetStatePath returns the location of the file that records what dotter has
+// created in the target directory
+func (exec Executor) GetStatePath() string {
+	path := exec.Configuration.Options.StateFile
+	if path == "" {
+		path = DefaultStateFile
+	}
+	if !filepath.IsAbs(path) {
+		path = exec.GetTargetPath(path)
+	}
+	return path
+}
+
+// withState loads the state file before calling fn, and saves it afterward
+// unless this is a dry run
+func (exec Executor) withState(fn func() error) error {
+	err := exec.State.Load()
+	if err != nil {
+		return err
+	}
+
+	err = fn()
+
+	if !exec.Configuration.Options.DryRun {
+		saveErr := exec.State.Save()
+		if err == nil {
+			err = saveErr
+		}
+	}
+
+	return err
+}
+
+func (exec Executor) report(event Event) {
 	if !exec.Configuration.Options.Quiet {
-		fmt.Printf(format, a...)
+		event.Time = time.Now()
+		exec.Reporter.Report(event)
 	}
 }
 
+func (exec Executor) reportStart(action string) {
+	exec.report(Event{
+		Type:   EventStart,
+		Action: action,
+		DryRun: exec.Configuration.Options.DryRun,
+		Source: exec.SourceDirectory,
+		Target: exec.TargetDirectory,
+		Config: exec.Configuration.SourcePath,
+	})
+}
+
 func (exec Executor) Execute() error {
-	exec.output(
-		cYellow("Installing %s to %s\n"),
-		cbYellow(exec.SourceDirectory),
-		cbYellow(exec.TargetDirectory),
-	)
-	if exec.Configuration.SourcePath != "" {
-		exec.output(
-			cYellow("Using %s\n"),
-			cbYellow(exec.Configuration.SourcePath),
-		)
+	return exec.withState(exec.execute)
+}
+
+func (exec Executor) execute() error {
+	dryRun := exec.Configuration.Options.DryRun
+	exec.reportStart("install")
+
+	summary := Summary{}
+	var firstErr error
+
+	for _, group := range exec.groupSteps(exec.Configuration.Steps) {
+		var err error
+		if len(group) == 1 {
+			err = exec.runStep(group[0], &summary)
+		} else {
+			err = exec.runParallel(group, &summary)
+		}
+
+		if err != nil {
+			if firstErr == nil {
+				firstErr = err
+			}
+			if exec.Configuration.Options.StopOnError {
+				break
+			}
+		}
 	}
 
-	for _, step := range exec.Configuration.Steps {
-		exec.output(
-			cGreen("%s: %s\n"),
-			step.GetActivityLabel(),
-			cbGreen(step.GetActivityDetails()),
-		)
-		err := step.Execute(exec)
+	exec.report(Event{Type: EventComplete, Action: "install", DryRun: dryRun, Summary: &summary})
+
+	if summary.Failed > 1 {
+		return fmt.Errorf("%d steps failed, the first with: %w", summary.Failed, firstErr)
+	}
+	return firstErr
+}
+
+// runStep executes (or, in a dry run, plans) a single step, recording its
+// outcome in the summary
+func (exec Executor) runStep(s step.Step, summary *Summary) error {
+	if ok, reason := exec.shouldRun(s); !ok {
+		event := newStepEvent(EventSkip, s)
+		event.Reason = reason
+		exec.report(event)
+		summary.Skipped++
+		return nil
+	}
+
+	exec.report(newStepEvent(EventStep, s))
+	started := time.Now()
+	var result step.Result
+	var err error
+	if exec.Configuration.Options.DryRun {
+		result, err = exec.reportPlan(s)
+	} else if err = exec.checkInteractive(s); err == nil {
+		result, err = s.Execute(exec)
+	}
+	event := newResultEvent(s, started, err)
+	if err == nil {
+		event.Status = result.Status.String()
+		event.Message = result.Message
+	}
+	exec.report(event)
+
+	if err != nil {
+		summary.Failed++
+	} else if result.Status.Changed() {
+		summary.Changed++
+	} else {
+		summary.Unchanged++
+	}
+	return err
+}
+
+// checkInteractive refuses interactive commands when reporting JSON, as
+// their output would go straight to the terminal and corrupt the report
+func (exec Executor) checkInteractive(s step.Step) error {
+	shell, ok := s.(step.ShellStep)
+	if !ok || !shell.Interactive {
+		return nil
+	}
+	if _, ok := exec.Reporter.(JSONReporter); ok {
+		return fmt.Errorf("Interactive commands cannot be run with JSON output: %s", shell.Command)
+	}
+	return nil
+}
+
+// isParallel determines whether or not a step may run at the same time as
+// its neighbours; only steps that opt in do, since otherwise there's no telling
+// what relies on the order of the configuration (and interactive commands
+// always run alone)
+func (exec Executor) isParallel(s step.Step) bool {
+	if shell, ok := s.(step.ShellStep); ok && shell.Interactive {
+		// They'd be fighting over the terminal
+		return false
+	}
+	parallel := s.GetMeta().Parallel
+	return parallel != nil && *parallel
+}
+
+// groupSteps splits the steps into groups that run one after another; the
+// steps within a group may run at the same time, so a step that depends on
+// another always starts a new group
+func (exec Executor) groupSteps(steps []step.Step) [][]step.Step {
+	groups := make([][]step.Step, 0, len(steps))
+	names := make(map[string]bool)
+
+	for idx, s := range steps {
+		last := len(groups) - 1
+		meta := s.GetMeta()
+		if idx > 0 && exec.isParallel(s) && exec.isParallel(steps[idx-1]) && !dependsOnAny(meta, names) {
+			groups[last] = append(groups[last], s)
+		} else {
+			groups = append(groups, []step.Step{s})
+			names = make(map[string]bool)
+		}
+		if meta.Name != "" {
+			names[meta.Name] = true
+		}
+	}
+
+	return groups
+}
+
+func dependsOnAny(meta step.StepMeta, names map[string]bool) bool {
+	for _, dependency := range meta.DependsOn {
+		if names[dependency] {
+			return true
+		}
+	}
+	return false
+}
+
+// getJobs returns the number of steps that can run at the same time
+func (exec Executor) getJobs() int {
+	if exec.Configuration.Options.Jobs > 0 {
+		return exec.Configuration.Options.Jobs
+	}
+	return DefaultJobs
+}
+
+// runParallel runs the steps at the same time, holding the output of each
+// until it is finished so that they don't interleave; no more steps are
+// started after a failure if the executor stops on errors
+func (exec Executor) runParallel(steps []step.Step, summary *Summary) error {
+	var firstErr error
+	var mutex sync.Mutex
+	var wg sync.WaitGroup
+	slots := make(chan bool, exec.getJobs())
+
+	for _, s := range steps {
+		slots <- true
+
+		mutex.Lock()
+		stop := firstErr != nil && exec.Configuration.Options.StopOnError
+		mutex.Unlock()
+		if stop {
+			<-slots
+			break
+		}
+
+		wg.Add(1)
+		go func(s step.Step) {
+			defer wg.Done()
+			defer func() { <-slots }()
+
+			buffer := &bufferedReporter{}
+			stepExec := exec
+			stepExec.Reporter = buffer
+			stepSummary := Summary{}
+			err := stepExec.runStep(s, &stepSummary)
+
+			mutex.Lock()
+			defer mutex.Unlock()
+			buffer.flush(exec.Reporter)
+			summary.add(stepSummary)
+			if err != nil && firstErr == nil {
+				firstErr = err
+			}
+		}(s)
+	}
+
+	wg.Wait()
+	return firstErr
+}
+
+func newResultEvent(s step.Step, started time.Time, err error) Event {
+	event := newStepEvent(EventResult, s)
+	event.Duration = time.Since(started)
+	if err != nil {
+		event.Error = err.Error()
+	}
+	return event
+}
+
+// reportPlan reports the changes that the step would make, and summarizes
+// them as the result the step would have
+func (exec Executor) reportPlan(s step.Step) (step.Result, error) {
+	changes, err := s.Plan(exec)
+	if err != nil {
+		return step.Result{}, err
+	}
+
+	event := newStepEvent(EventPlan, s)
+	event.Changes = changes
+	exec.report(event)
+
+	if len(changes) == 0 {
+		return step.NewResult(step.ResultUnchanged, "no changes"), nil
+	}
+	return step.NewResult(planStatus(changes), "%d change(s)", len(changes)), nil
+}
+
+func planStatus(changes []step.Change) step.ResultStatus {
+	status := step.ResultUpdated
+	for _, change := range changes {
+		switch change.Type {
+		case step.ChangeReplace:
+			return step.ResultReplaced
+		case step.ChangeCreate:
+			status = step.ResultCreated
+		}
+	}
+	return status
+}
+
+// Uninstall reverses the steps that can be undone, in the opposite order that
+// they were installed, and then removes any other links that the state file
+// says this configuration created, if they still point where they did
+func (exec Executor) Uninstall() error {
+	if exec.Configuration.Options.DryRun {
+		return fmt.Errorf("Uninstalling does not support dry runs")
+	}
+	return exec.withState(exec.uninstall)
+}
+
+func (exec Executor) uninstall() error {
+	exec.reportStart("uninstall")
+
+	failed := 0
+	var firstErr error
+
+	steps := exec.Configuration.Steps
+	for idx := len(steps) - 1; idx >= 0; idx-- {
+		uninstaller, ok := steps[idx].(step.Uninstaller)
+		if !ok {
+			continue
+		}
+		if _, isDir := steps[idx].(step.DirectoryStep); isDir && !exec.Configuration.Options.RemoveDirectories {
+			continue
+		}
+		if ok, _ := exec.shouldRun(steps[idx]); !ok {
+			continue
+		}
+
+		event := newStepEvent(EventStep, steps[idx])
+		event.Label = "Uninstalling"
+		exec.report(event)
+		started := time.Now()
+		err := uninstaller.Uninstall(exec)
+		exec.report(newResultEvent(steps[idx], started, err))
 
 		if err != nil {
-			// TODO print error
+			failed++
+			if firstErr == nil {
+				firstErr = err
+			}
 			if exec.Configuration.Options.StopOnError {
 				return err
 			}
 		}
 	}
 
-	exec.output(cbYellow("Complete.\n"))
-	return nil
+	configured := exec.configuredLinks()
+	options := exec.Configuration.Options
+	filtered := len(options.Tags) > 0 || len(options.SkipTags) > 0
+	for _, entry := range exec.trackedLinks() {
+		if s, ok := configured[entry.Path]; ok {
+			if ok, _ := exec.shouldRun(s); !ok {
+				continue
+			}
+		} else if filtered {
+			// There's no telling which tags a link that is no longer
+			// configured had, so only clean those up when running everything
+			continue
+		}
+
+		err := exec.removeTrackedLink(entry)
+
+		if err != nil {
+			exec.PrintError(err.Error())
+			failed++
+			if firstErr == nil {
+				firstErr = err
+			}
+			if exec.Configuration.Options.StopOnError {
+				return err
+			}
+		}
+	}
+
+	exec.report(Event{Type: EventComplete, Action: "uninstall"})
+
+	if failed > 1 {
+		return fmt.Errorf("%d steps failed, the first with: %w", failed, firstErr)
+	}
+	return firstErr
+}
+
+func (exec Executor) removeTrackedLink(entry StateEntry) error {
+	current, err := os.Readlink(entry.Path)
+	if err != nil || current != entry.Source {
+		// It's gone or has been changed by someone else, so forget about it
+		exec.State.Untrack(entry.Path)
+		return nil
+	}
+
+	exec.report(Event{
+		Type:    EventStep,
+		Step:    step.TrackedLink,
+		Label:   "Uninstalling",
+		Details: entry.Path,
+		Source:  entry.Source,
+		Target:  entry.Path,
+	})
+	err = os.Remove(entry.Path)
+	if err != nil {
+		return err
+	}
+	exec.State.Untrack(entry.Path)
+	exec.PrintInfo(fmt.Sprintf("Removed %s", entry.Path))
+
+	_, err = exec.RestoreBackup(entry.Path)
+	return err
+}
+
+// trackedLinks returns the links in the state file that were created by this
+// configuration, leaving out those of any other configuration installed into
+// the same target directory
+func (exec Executor) trackedLinks() []StateEntry {
+	links := make([]StateEntry, 0)
+	for _, entry := range exec.State.Links() {
+		if entry.Config == exec.Configuration.SourcePath {
+			links = append(links, entry)
+		}
+	}
+	return links
+}
+
+// configuredLinks returns the link steps of the configuration by the path
+// they link
+func (exec Executor) configuredLinks() map[string]step.Step {
+	configured := make(map[string]step.Step)
+	for _, s := range exec.Configuration.Steps {
+		if link, ok := s.(step.LinkStep); ok {
+			configured[exec.GetTargetPath(link.Target)] = s
+		}
+	}
+	return configured
+}
+
+// findOrphanedLinks returns the tracked links that are no longer part of the configuration
+func (exec Executor) findOrphanedLinks() []StateEntry {
+	configured := exec.configuredLinks()
+
+	orphaned := make([]StateEntry, 0)
+	for _, entry := range exec.trackedLinks() {
+		if _, ok := configured[entry.Path]; !ok {
+			orphaned = append(orphaned, entry)
+		}
+	}
+	return orphaned
+}
+
+// Status checks each step against the target directory without changing
+// anything, and returns the number of steps that have drifted plus the number
+// of links recorded in the state file that are no longer configured
+func (exec Executor) Status() int {
+	exec.reportStart("status")
+
+	// Steps check the state to tell the files they wrote from the user's
+	err := exec.State.Load()
+	if err != nil {
+		exec.PrintError(err.Error())
+	}
+
+	drifted := 0
+
+	for _, step := range exec.Configuration.Steps {
+		if ok, _ := exec.shouldRun(step); !ok {
+			continue
+		}
+
+		changes, err := step.Plan(exec)
+		if err == nil {
+			changes = withoutCommands(changes)
+			if len(changes) == 0 {
+				continue
+			}
+		}
+
+		drifted++
+		exec.report(newStepEvent(EventStep, step))
+		if err != nil {
+			exec.PrintError(err.Error())
+			continue
+		}
+		event := newStepEvent(EventPlan, step)
+		event.Changes = changes
+		exec.report(event)
+	}
+
+	for _, entry := range exec.findOrphanedLinks() {
+		drifted++
+		exec.report(Event{
+			Type:    EventOrphan,
+			Step:    step.TrackedLink,
+			Source:  entry.Source,
+			Target:  entry.Path,
+			Config:  entry.Config,
+			Message: fmt.Sprintf("Linked to %s by %s at %s", entry.Source, entry.Config, entry.Time.Format(time.RFC3339)),
+		})
+	}
+
+	exec.report(Event{Type: EventComplete, Action: "status", Drift: drifted})
+
+	return drifted
+}
+
+func withoutCommands(changes []step.Change) []step.Change {
+	filtered := make([]step.Change, 0, len(changes))
+	for _, change := range changes {
+		if change.Type != step.ChangeRun {
+			filtered = append(filtered, change)
+		}
+	}
+	return filtered
+}
+
+// shouldRun determines whether or not the step was selected by its tags and
+// whether its conditions pass, returning the reason if it should be skipped
+func (exec Executor) shouldRun(s step.Step) (bool, string) {
+	meta := s.GetMeta()
+	options := exec.Configuration.Options
+
+	if len(options.SkipTags) > 0 && meta.HasTag(options.SkipTags...) {
+		return false, fmt.Sprintf("tagged %s", strings.Join(options.SkipTags, ", "))
+	}
+	if len(options.Tags) > 0 && !meta.HasTag(options.Tags...) && !meta.HasTag(AlwaysTag) {
+		return false, fmt.Sprintf("not tagged %s", strings.Join(options.Tags, ", "))
+	}
+
+	return meta.Check(exec)
 }
 
 func (exec Executor) GetTargetPath(path string) string {
@@ -81,34 +571,183 @@ func (exec Executor) GetSourcePath(path string) string {
 
 func (exec Executor) ForceRemove(path string) error {
 	if exec.Configuration.Options.BackupForced != "" {
-		fmt.Printf("Backing up %s...\n", path)
+		backupPath, err := exec.backup(path)
+		if err != nil {
+			return err
+		}
+		exec.Track(TrackedBackup, backupPath, path)
+		exec.report(Event{Type: EventBackup, Source: path, Target: backupPath})
+		return nil
 	}
 
 	return os.RemoveAll(path)
 }
 
-func (exec Executor) PrintInfo(message string) {
-	for _, line := range indentString(message) {
-		exec.output("%s\n", cbCyan(line))
+// GetBackupDirectory returns the directory that forcibly-removed files are
+// moved to, or an empty string if backups are not enabled
+func (exec Executor) GetBackupDirectory() string {
+	dir := exec.Configuration.Options.BackupForced
+	if dir != "" && !filepath.IsAbs(dir) {
+		dir = exec.GetTargetPath(dir)
 	}
+	return dir
 }
 
-func (exec Executor) PrintError(message string) {
-	for _, line := range indentString(message) {
-		exec.output("%s\n", cbRed(line))
+// getBackupPrefix returns the path that backups of the specified path start
+// with; a timestamp is added to it to name each backup
+func (exec Executor) getBackupPrefix(path string) string {
+	rel := filepath.Clean(path)
+	if step.IsWithin(rel, exec.TargetDirectory) {
+		rel, _ = filepath.Rel(exec.TargetDirectory, rel)
+	} else {
+		rel = strings.TrimPrefix(rel, string(filepath.Separator))
 	}
+
+	return filepath.Join(exec.GetBackupDirectory(), rel) + "."
 }
 
-func indentString(value string) []string {
-	lines := strings.Split(value, "\n")
-	indented := make([]string, 0, len(lines))
+func (exec Executor) getBackupPath(path string) string {
+	backupPath := exec.getBackupPrefix(path) + time.Now().Format(backupTimeFormat)
 
-	for idx, line := range lines {
-		if line == "" && idx == (len(lines)-1) {
-			break
+	candidate := backupPath
+	for idx := 1; ; idx++ {
+		if _, err := os.Lstat(candidate); os.IsNotExist(err) {
+			return candidate
+		}
+		candidate = fmt.Sprintf("%s-%d", backupPath, idx)
+	}
+}
+
+// RestoreBackup moves the most recent backup of the specified path back into
+// place, returning whether or not a backup was found
+func (exec Executor) RestoreBackup(path string) (bool, error) {
+	if exec.GetBackupDirectory() == "" {
+		return false, nil
+	}
+
+	backupPath, err := exec.findLatestBackup(path)
+	if err != nil || backupPath == "" {
+		return false, err
+	}
+
+	err = movePath(backupPath, path)
+	if err != nil {
+		return false, err
+	}
+	exec.State.Untrack(backupPath)
+	exec.report(Event{Type: EventRestore, Source: backupPath, Target: path})
+
+	return true, nil
+}
+
+func (exec Executor) findLatestBackup(path string) (string, error) {
+	backupDir, backupName := filepath.Split(exec.getBackupPrefix(path))
+	children, err := ioutil.ReadDir(backupDir)
+	if os.IsNotExist(err) {
+		return "", nil
+	} else if err != nil {
+		return "", err
+	}
+
+	latest := ""
+	latestTime := time.Time{}
+	latestIndex := -1
+
+	for _, child := range children {
+		if !strings.HasPrefix(child.Name(), backupName) {
+			continue
+		}
+		stamp := strings.TrimPrefix(child.Name(), backupName)
+		index := 0
+		if dash := strings.Index(stamp, "-"); dash >= 0 {
+			index, err = strconv.Atoi(stamp[dash+1:])
+			if err != nil {
+				continue
+			}
+			stamp = stamp[:dash]
+		}
+		stampTime, err := time.Parse(backupTimeFormat, stamp)
+		if err != nil {
+			continue
+		}
+
+		if stampTime.After(latestTime) || (stampTime.Equal(latestTime) && index > latestIndex) {
+			latest = filepath.Join(backupDir, child.Name())
+			latestTime = stampTime
+			latestIndex = index
 		}
-		indented = append(indented, "    "+line)
 	}
 
-	return indented
+	return latest, nil
+}
+
+func (exec Executor) backup(path string) (string, error) {
+	backupPath := exec.getBackupPath(path)
+
+	err := os.MkdirAll(filepath.Dir(backupPath), os.FileMode(0o755))
+	if err != nil {
+		return "", err
+	}
+
+	err = movePath(path, backupPath)
+	if err != nil {
+		return "", err
+	}
+
+	return backupPath, nil
+}
+
+func movePath(source string, destination string) error {
+	err := os.Rename(source, destination)
+	if err != nil {
+		// Probably on a different device, fall back to a copy
+		err = step.CopyPath(source, destination)
+		if err != nil {
+			return err
+		}
+		return os.RemoveAll(source)
+	}
+
+	return nil
+}
+
+// Track records something that was created in the state file
+func (exec Executor) Track(trackedType string, path string, source string) {
+	exec.State.Track(StateEntry{
+		Type:   trackedType,
+		Path:   path,
+		Source: source,
+		Config: exec.Configuration.SourcePath,
+		Time:   time.Now(),
+	})
+}
+
+// Untrack removes everything recorded about the specified path from the state file
+func (exec Executor) Untrack(path string) {
+	exec.State.Untrack(path)
+}
+
+// IsTracked indicates whether or not the state file says that dotter created the specified path
+func (exec Executor) IsTracked(path string) bool {
+	for _, trackedType := range []string{step.TrackedLink, step.TrackedDirectory, step.TrackedFile} {
+		if _, ok := exec.State.Find(trackedType, path); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// FindTracked returns the source recorded in the state file for the specified
+// type of entry and path
+func (exec Executor) FindTracked(trackedType string, path string) (string, bool) {
+	entry, ok := exec.State.Find(trackedType, path)
+	return entry.Source, ok
+}
+
+func (exec Executor) PrintInfo(message string) {
+	exec.report(Event{Type: EventInfo, Message: message})
+}
+
+func (exec Executor) PrintError(message string) {
+	exec.report(Event{Type: EventError, Message: message})
 }
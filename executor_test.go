@@ -0,0 +1,633 @@
+package dotter_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	"github.com/jayclassless/dotter"
+)
+
+var _ = Describe("Executor", func() {
+	var sourceDir string
+	var targetDir string
+
+	BeforeEach(func() {
+		sourceDir = tmpdir()
+		targetDir = tmpdir()
+	})
+
+	AfterEach(func() {
+		rmdir(sourceDir)
+		rmdir(targetDir)
+	})
+
+	newExecutor := func(cfg dotter.Configuration) dotter.Executor {
+		cfg.Options.Quiet = true
+		return dotter.NewExecutor(sourceDir, targetDir, cfg)
+	}
+
+	Describe("ForceRemove", func() {
+		It("Removes without backups", func() {
+			writeFile(targetDir, ".bashrc", "mine")
+			exec := newExecutor(dotter.NewConfiguration())
+
+			err := exec.ForceRemove(filepath.Join(targetDir, ".bashrc"))
+			Expect(err).Should(Succeed())
+
+			_, err = os.Lstat(filepath.Join(targetDir, ".bashrc"))
+			Expect(os.IsNotExist(err)).To(BeTrue())
+		})
+
+		It("Moves files to the backup directory", func() {
+			mkdir(targetDir, ".config")
+			writeFile(targetDir, ".config/foo", "mine")
+			cfg := dotter.NewConfiguration()
+			cfg.Options.BackupForced = ".backup"
+			exec := newExecutor(cfg)
+
+			err := exec.ForceRemove(filepath.Join(targetDir, ".config/foo"))
+			Expect(err).Should(Succeed())
+
+			_, err = os.Lstat(filepath.Join(targetDir, ".config/foo"))
+			Expect(os.IsNotExist(err)).To(BeTrue())
+
+			matches, _ := filepath.Glob(filepath.Join(targetDir, ".backup", ".config", "foo.*"))
+			Expect(matches).To(HaveLen(1))
+			content, err := ioutil.ReadFile(matches[0])
+			Expect(err).Should(Succeed())
+			Expect(string(content)).To(Equal("mine"))
+		})
+
+		It("Moves directory trees to an absolute backup directory", func() {
+			backupDir := tmpdir()
+			defer rmdir(backupDir)
+			mkdir(targetDir, "foo", "bar")
+			writeFile(targetDir, "foo/bar/baz", "mine")
+			cfg := dotter.NewConfiguration()
+			cfg.Options.BackupForced = backupDir
+			exec := newExecutor(cfg)
+
+			err := exec.ForceRemove(filepath.Join(targetDir, "foo"))
+			Expect(err).Should(Succeed())
+
+			matches, _ := filepath.Glob(filepath.Join(backupDir, "foo.*", "bar", "baz"))
+			Expect(matches).To(HaveLen(1))
+		})
+
+		It("Does not overwrite earlier backups", func() {
+			cfg := dotter.NewConfiguration()
+			cfg.Options.BackupForced = ".backup"
+			exec := newExecutor(cfg)
+
+			writeFile(targetDir, "foo", "first")
+			Expect(exec.ForceRemove(filepath.Join(targetDir, "foo"))).Should(Succeed())
+			writeFile(targetDir, "foo", "second")
+			Expect(exec.ForceRemove(filepath.Join(targetDir, "foo"))).Should(Succeed())
+
+			matches, _ := filepath.Glob(filepath.Join(targetDir, ".backup", "foo.*"))
+			Expect(matches).To(HaveLen(2))
+		})
+	})
+
+	Describe("Execute", func() {
+		Describe("Tags", func() {
+			var cfg dotter.Configuration
+
+			BeforeEach(func() {
+				var err error
+				cfg, err = dotter.NewConfigurationFromYaml([]byte(`
+steps:
+  - directory:
+    - work
+    tags: work
+  - directory:
+    - personal
+    tags: personal
+  - directory:
+    - untagged
+  - directory:
+    - always
+    tags: always
+`))
+				Expect(err).Should(Succeed())
+			})
+
+			created := func() []string {
+				names := make([]string, 0)
+				children, _ := ioutil.ReadDir(targetDir)
+				for _, child := range children {
+					if child.IsDir() {
+						names = append(names, child.Name())
+					}
+				}
+				return names
+			}
+
+			It("Runs everything when no tags are selected", func() {
+				Expect(newExecutor(cfg).Execute()).Should(Succeed())
+				Expect(created()).To(ConsistOf("work", "personal", "untagged", "always"))
+			})
+
+			It("Runs only the selected tags", func() {
+				cfg.Options.Tags = []string{"work"}
+				Expect(newExecutor(cfg).Execute()).Should(Succeed())
+				Expect(created()).To(ConsistOf("work", "always"))
+			})
+
+			It("Skips the skipped tags", func() {
+				cfg.Options.SkipTags = []string{"work", "always"}
+				Expect(newExecutor(cfg).Execute()).Should(Succeed())
+				Expect(created()).To(ConsistOf("personal", "untagged"))
+			})
+		})
+
+		It("Skips steps whose conditions fail", func() {
+			cfg, err := dotter.NewConfigurationFromYaml([]byte(`
+steps:
+  - directory:
+    - foo
+    when:
+      os: plan9
+  - directory:
+    - bar
+    when:
+      test: "true"
+`))
+			Expect(err).Should(Succeed())
+
+			err = newExecutor(cfg).Execute()
+			Expect(err).Should(Succeed())
+
+			_, err = os.Stat(filepath.Join(targetDir, "foo"))
+			Expect(os.IsNotExist(err)).To(BeTrue())
+			_, err = os.Stat(filepath.Join(targetDir, "bar"))
+			Expect(err).Should(Succeed())
+		})
+
+		It("Fails after running the remaining steps when continuing on error", func() {
+			cfg, err := dotter.NewConfigurationFromYaml([]byte(`
+steps:
+  - shell:
+    - exit 1
+  - directory:
+    - foo
+`))
+			Expect(err).Should(Succeed())
+			cfg.Options.StopOnError = false
+
+			err = newExecutor(cfg).Execute()
+			Expect(err).To(MatchError(ContainSubstring("exit status 1")))
+
+			_, err = os.Stat(filepath.Join(targetDir, "foo"))
+			Expect(err).Should(Succeed())
+		})
+
+		It("Stops at the first failure", func() {
+			cfg, err := dotter.NewConfigurationFromYaml([]byte(`
+steps:
+  - shell:
+    - exit 1
+  - directory:
+    - foo
+`))
+			Expect(err).Should(Succeed())
+
+			err = newExecutor(cfg).Execute()
+			Expect(err).To(MatchError(ContainSubstring("exit status 1")))
+
+			_, err = os.Stat(filepath.Join(targetDir, "foo"))
+			Expect(os.IsNotExist(err)).To(BeTrue())
+		})
+
+		It("Refuses interactive commands with JSON output", func() {
+			cfg, err := dotter.NewConfigurationFromYaml([]byte(`
+steps:
+  - shell:
+    - command: touch ran
+      interactive: true
+`))
+			Expect(err).Should(Succeed())
+
+			var output bytes.Buffer
+			exec := dotter.NewExecutor(sourceDir, targetDir, cfg)
+			exec.Reporter = dotter.NewJSONReporter(&output)
+			Expect(exec.Execute()).To(MatchError(ContainSubstring("cannot be run with JSON output")))
+			_, err = os.Stat(filepath.Join(sourceDir, "ran"))
+			Expect(os.IsNotExist(err)).To(BeTrue())
+		})
+
+		Describe("Parallel", func() {
+			var output bytes.Buffer
+
+			BeforeEach(func() {
+				output.Reset()
+			})
+
+			run := func(cfg dotter.Configuration) (time.Duration, []string) {
+				exec := dotter.NewExecutor(sourceDir, targetDir, cfg)
+				exec.Reporter = dotter.NewJSONReporter(&output)
+				started := time.Now()
+				Expect(exec.Execute()).Should(Succeed())
+				elapsed := time.Since(started)
+
+				events := make([]string, 0)
+				decoder := json.NewDecoder(&output)
+				for decoder.More() {
+					event := dotter.Event{}
+					Expect(decoder.Decode(&event)).Should(Succeed())
+					switch event.Type {
+					case dotter.EventStep, dotter.EventResult:
+						events = append(events, string(event.Type)+" "+event.Details)
+					case dotter.EventInfo:
+						events = append(events, string(event.Type)+" "+strings.TrimSpace(event.Message))
+					}
+				}
+				return elapsed, events
+			}
+
+			It("Runs blocks marked parallel at the same time", func() {
+				cfg, err := dotter.NewConfigurationFromYaml([]byte(`
+options:
+  defaults:
+    shell:
+      quiet: false
+steps:
+  - shell:
+    - sleep 0.5 && echo one
+    - sleep 0.5 && echo two
+    - sleep 0.5 && echo three
+    parallel: true
+`))
+				Expect(err).Should(Succeed())
+
+				elapsed, events := run(cfg)
+				Expect(elapsed).To(BeNumerically("<", 1400*time.Millisecond))
+				Expect(events).To(HaveLen(9))
+				for idx := 0; idx < len(events); idx += 3 {
+					// Each step's output is kept together
+					command := strings.TrimPrefix(events[idx], "step ")
+					Expect(events[idx+1]).To(Equal("info " + command[strings.LastIndex(command, " ")+1:]))
+					Expect(events[idx+2]).To(Equal("result " + command))
+				}
+			})
+
+			It("Limits parallel steps to the number of jobs", func() {
+				cfg, err := dotter.NewConfigurationFromYaml([]byte(`
+steps:
+  - shell:
+    - sleep 0.3
+    - sleep 0.3
+    - sleep 0.3
+    - sleep 0.3
+    parallel: true
+`))
+				Expect(err).Should(Succeed())
+				cfg.Options.Jobs = 2
+
+				elapsed, _ := run(cfg)
+				Expect(elapsed).To(BeNumerically(">=", 600*time.Millisecond))
+				Expect(elapsed).To(BeNumerically("<", 1100*time.Millisecond))
+			})
+
+			It("Keeps steps that don't opt in in order", func() {
+				cfg, err := dotter.NewConfigurationFromYaml([]byte(`
+steps:
+  - shell:
+    - mkdir d
+  - shell:
+    - sleep 0.3 && touch d/f
+  - shell:
+    - test -f d/f
+`))
+				Expect(err).Should(Succeed())
+				cfg.Options.Jobs = 2
+
+				_, events := run(cfg)
+				Expect(events).To(Equal([]string{
+					"step mkdir d",
+					"result mkdir d",
+					"step sleep 0.3 && touch d/f",
+					"result sleep 0.3 && touch d/f",
+					"step test -f d/f",
+					"result test -f d/f",
+				}))
+			})
+
+			It("Keeps steps that opt out in order", func() {
+				cfg, err := dotter.NewConfigurationFromYaml([]byte(`
+steps:
+  - shell:
+    - sleep 0.3 && touch first
+    - sleep 0.3
+    parallel: true
+  - shell:
+    - test -f first
+    parallel: false
+  - shell:
+    - sleep 0.3
+    parallel: true
+`))
+				Expect(err).Should(Succeed())
+				cfg.Options.Jobs = 2
+
+				elapsed, events := run(cfg)
+				Expect(elapsed).To(BeNumerically(">=", 600*time.Millisecond))
+				Expect(events[4]).To(Equal("step test -f first"))
+				Expect(events[5]).To(Equal("result test -f first"))
+			})
+		})
+
+		It("Runs dependencies first when running in parallel", func() {
+			cfg, err := dotter.NewConfigurationFromYaml([]byte(`
+steps:
+  - shell:
+    - test -f first
+    depends_on: first
+    parallel: true
+  - shell:
+    - sleep 0.3 && touch first
+    name: first
+    parallel: true
+`))
+			Expect(err).Should(Succeed())
+			cfg.Options.Jobs = 2
+
+			Expect(newExecutor(cfg).Execute()).Should(Succeed())
+		})
+
+		It("Makes no changes in dry run mode", func() {
+			cfg, err := dotter.NewConfigurationFromYaml([]byte(`
+steps:
+  - directory:
+    - foo
+  - link:
+      bar: bar
+  - shell:
+    - touch baz
+`))
+			Expect(err).Should(Succeed())
+			cfg.Options.DryRun = true
+
+			err = newExecutor(cfg).Execute()
+			Expect(err).Should(Succeed())
+
+			children, _ := ioutil.ReadDir(targetDir)
+			Expect(children).To(HaveLen(0))
+		})
+	})
+
+	Describe("Status", func() {
+		var cfg dotter.Configuration
+
+		BeforeEach(func() {
+			var err error
+			cfg, err = dotter.NewConfigurationFromYaml([]byte(`
+steps:
+  - directory:
+    - path: foo
+      mode: 0o700
+  - link:
+      bar: bar
+  - shell:
+    - touch baz
+`))
+			Expect(err).Should(Succeed())
+		})
+
+		It("Reports drift", func() {
+			Expect(newExecutor(cfg).Status()).To(Equal(2))
+
+			children, _ := ioutil.ReadDir(targetDir)
+			Expect(children).To(HaveLen(0))
+		})
+
+		It("Reports blocked links and wrong modes", func() {
+			mkdir(targetDir, "foo")
+			os.Chmod(filepath.Join(targetDir, "foo"), 0o755)
+			writeFile(targetDir, "bar", "bar")
+
+			Expect(newExecutor(cfg).Status()).To(Equal(2))
+		})
+
+		It("Ignores shell steps when nothing has drifted", func() {
+			Expect(newExecutor(cfg).Execute()).Should(Succeed())
+
+			Expect(newExecutor(cfg).Status()).To(Equal(0))
+		})
+
+		It("Reports changed sources of files it wrote", func() {
+			writeFile(sourceDir, "npmrc", "one")
+			cfg, err := dotter.NewConfigurationFromYaml([]byte(`
+steps:
+  - copy:
+      .npmrc: npmrc
+`))
+			Expect(err).Should(Succeed())
+			Expect(newExecutor(cfg).Execute()).Should(Succeed())
+			writeFile(sourceDir, "npmrc", "two")
+
+			var output bytes.Buffer
+			exec := dotter.NewExecutor(sourceDir, targetDir, cfg)
+			exec.Reporter = dotter.NewJSONReporter(&output)
+			Expect(exec.Status()).To(Equal(1))
+
+			types := make([]string, 0)
+			decoder := json.NewDecoder(&output)
+			for decoder.More() {
+				event := struct {
+					Type string `json:"event"`
+				}{}
+				Expect(decoder.Decode(&event)).Should(Succeed())
+				types = append(types, event.Type)
+			}
+			Expect(types).To(ContainElement(string(dotter.EventPlan)))
+			Expect(types).ToNot(ContainElement(string(dotter.EventError)))
+		})
+	})
+
+	Describe("Uninstall", func() {
+		It("Removes links and restores backups", func() {
+			writeFile(targetDir, ".bashrc", "mine")
+			cfg, err := dotter.NewConfigurationFromYaml([]byte(`
+options:
+  backupforced: .backup
+steps:
+  - directory:
+    - foo
+  - link:
+      .bashrc:
+        source: bashrc
+        force: true
+      .zshrc: zshrc
+`))
+			Expect(err).Should(Succeed())
+			Expect(newExecutor(cfg).Execute()).Should(Succeed())
+
+			err = newExecutor(cfg).Uninstall()
+			Expect(err).Should(Succeed())
+
+			content, err := ioutil.ReadFile(filepath.Join(targetDir, ".bashrc"))
+			Expect(err).Should(Succeed())
+			Expect(string(content)).To(Equal("mine"))
+			_, err = os.Lstat(filepath.Join(targetDir, ".zshrc"))
+			Expect(os.IsNotExist(err)).To(BeTrue())
+			_, err = os.Stat(filepath.Join(targetDir, "foo"))
+			Expect(err).Should(Succeed())
+		})
+
+		It("Removes empty directories when configured", func() {
+			cfg, err := dotter.NewConfigurationFromYaml([]byte(`
+steps:
+  - directory:
+    - foo
+`))
+			Expect(err).Should(Succeed())
+			Expect(newExecutor(cfg).Execute()).Should(Succeed())
+
+			cfg.Options.RemoveDirectories = true
+			err = newExecutor(cfg).Uninstall()
+			Expect(err).Should(Succeed())
+
+			_, err = os.Stat(filepath.Join(targetDir, "foo"))
+			Expect(os.IsNotExist(err)).To(BeTrue())
+		})
+
+		It("Only removes links selected by the tags", func() {
+			cfg, err := dotter.NewConfigurationFromYaml([]byte(`
+steps:
+  - link:
+      .gitconfig: gitconfig
+    tags: work
+  - link:
+      .zshrc: zshrc
+    tags: home
+`))
+			Expect(err).Should(Succeed())
+			Expect(newExecutor(cfg).Execute()).Should(Succeed())
+
+			cfg.Options.Tags = []string{"work"}
+			Expect(newExecutor(cfg).Uninstall()).Should(Succeed())
+			_, err = os.Lstat(filepath.Join(targetDir, ".gitconfig"))
+			Expect(os.IsNotExist(err)).To(BeTrue())
+			_, err = os.Lstat(filepath.Join(targetDir, ".zshrc"))
+			Expect(err).Should(Succeed())
+		})
+
+		It("Refuses dry runs", func() {
+			cfg, err := dotter.NewConfigurationFromYaml([]byte(`
+steps:
+  - link:
+      .zshrc: zshrc
+`))
+			Expect(err).Should(Succeed())
+			Expect(newExecutor(cfg).Execute()).Should(Succeed())
+
+			cfg.Options.DryRun = true
+			Expect(newExecutor(cfg).Uninstall()).To(MatchError("Uninstalling does not support dry runs"))
+			_, err = os.Lstat(filepath.Join(targetDir, ".zshrc"))
+			Expect(err).Should(Succeed())
+		})
+	})
+
+	Describe("State", func() {
+		var cfg dotter.Configuration
+
+		BeforeEach(func() {
+			var err error
+			cfg, err = dotter.NewConfigurationFromYaml([]byte(`
+steps:
+  - directory:
+    - foo
+  - link:
+      bar: bar
+`))
+			Expect(err).Should(Succeed())
+		})
+
+		It("Records what was created", func() {
+			Expect(newExecutor(cfg).Execute()).Should(Succeed())
+
+			state := dotter.NewState(filepath.Join(targetDir, dotter.DefaultStateFile))
+			Expect(state.Load()).Should(Succeed())
+			Expect(state.Entries).To(HaveLen(2))
+			Expect(state.Links()[0].Path).To(Equal(filepath.Join(targetDir, "bar")))
+		})
+
+		It("Remembers which commands have run", func() {
+			writeFile(sourceDir, "packages.txt", "git")
+			cfg, err := dotter.NewConfigurationFromYaml([]byte(`
+steps:
+  - shell:
+    - command: echo once >> log
+      run: once
+    - command: echo onchange >> log
+      run: onchange
+      files: packages.txt
+`))
+			Expect(err).Should(Succeed())
+
+			Expect(newExecutor(cfg).Execute()).Should(Succeed())
+			Expect(newExecutor(cfg).Execute()).Should(Succeed())
+			writeFile(sourceDir, "packages.txt", "git\njq")
+			Expect(newExecutor(cfg).Execute()).Should(Succeed())
+
+			content, err := ioutil.ReadFile(filepath.Join(targetDir, "log"))
+			Expect(err).Should(Succeed())
+			Expect(string(content)).To(Equal("once\nonchange\nonchange\n"))
+		})
+
+		It("Writes nothing in dry run mode", func() {
+			cfg.Options.DryRun = true
+			Expect(newExecutor(cfg).Execute()).Should(Succeed())
+
+			_, err := os.Stat(filepath.Join(targetDir, dotter.DefaultStateFile))
+			Expect(os.IsNotExist(err)).To(BeTrue())
+		})
+
+		It("Reports and uninstalls links that are no longer configured", func() {
+			Expect(newExecutor(cfg).Execute()).Should(Succeed())
+
+			trimmed, err := dotter.NewConfigurationFromYaml([]byte(`
+steps:
+  - directory:
+    - foo
+`))
+			Expect(err).Should(Succeed())
+			Expect(newExecutor(trimmed).Status()).To(Equal(1))
+
+			Expect(newExecutor(trimmed).Uninstall()).Should(Succeed())
+			_, err = os.Lstat(filepath.Join(targetDir, "bar"))
+			Expect(os.IsNotExist(err)).To(BeTrue())
+			Expect(newExecutor(trimmed).Status()).To(Equal(0))
+		})
+
+		It("Leaves links from other configurations alone", func() {
+			cfg.SourcePath = filepath.Join(sourceDir, "a", "dotter.yaml")
+			Expect(newExecutor(cfg).Execute()).Should(Succeed())
+
+			other, err := dotter.NewConfigurationFromYaml([]byte(`
+steps:
+  - link:
+      baz: baz
+`))
+			Expect(err).Should(Succeed())
+			other.SourcePath = filepath.Join(sourceDir, "b", "dotter.yaml")
+			Expect(newExecutor(other).Execute()).Should(Succeed())
+
+			Expect(newExecutor(cfg).Status()).To(Equal(0))
+			Expect(newExecutor(cfg).Uninstall()).Should(Succeed())
+			_, err = os.Lstat(filepath.Join(targetDir, "bar"))
+			Expect(os.IsNotExist(err)).To(BeTrue())
+			_, err = os.Lstat(filepath.Join(targetDir, "baz"))
+			Expect(err).Should(Succeed())
+		})
+	})
+})
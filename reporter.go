@@ -0,0 +1,332 @@
+package dotter
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/fatih/color"
+
+	"github.com/jayclassless/dotter/step"
+)
+
+// EventType categorizes the Events reported by the Executor
+type EventType string
+
+const (
+	// EventStart is reported when the Executor begins working
+	EventStart EventType = "start"
+	// EventStep is reported when a Step is started
+	EventStep EventType = "step"
+	// EventSkip is reported when a Step is not run
+	EventSkip EventType = "skip"
+	// EventPlan is reported with the changes that a Step would make
+	EventPlan EventType = "plan"
+	// EventResult is reported when a Step has finished
+	EventResult EventType = "result"
+	// EventBackup is reported when something is moved to the backup directory
+	EventBackup EventType = "backup"
+	// EventRestore is reported when something is moved back from the backup directory
+	EventRestore EventType = "restore"
+	// EventOrphan is reported when a tracked link is no longer configured
+	EventOrphan EventType = "orphan"
+	// EventInfo is reported for informational messages
+	EventInfo EventType = "info"
+	// EventError is reported for error messages
+	EventError EventType = "error"
+	// EventComplete is reported when the Executor has finished working
+	EventComplete EventType = "complete"
+)
+
+// Event describes something that happened while the Executor was working
+type Event struct {
+	Type     EventType     `json:"event"`
+	Time     time.Time     `json:"time"`
+	Action   string        `json:"action,omitempty"`
+	DryRun   bool          `json:"dry_run,omitempty"`
+	Step     string        `json:"step,omitempty"`
+	Name     string        `json:"name,omitempty"`
+	Label    string        `json:"label,omitempty"`
+	Details  string        `json:"details,omitempty"`
+	Source   string        `json:"source,omitempty"`
+	Target   string        `json:"target,omitempty"`
+	Config   string        `json:"config,omitempty"`
+	Reason   string        `json:"reason,omitempty"`
+	Status   string        `json:"status,omitempty"`
+	Changes  []step.Change `json:"changes,omitempty"`
+	Message  string        `json:"message,omitempty"`
+	Error    string        `json:"error,omitempty"`
+	Drift    int           `json:"drift,omitempty"`
+	Summary  *Summary      `json:"summary,omitempty"`
+	Duration time.Duration `json:"-"`
+}
+
+// MarshalJSON encodes the Event, with its duration in seconds
+func (event Event) MarshalJSON() ([]byte, error) {
+	type plainEvent Event
+	return json.Marshal(struct {
+		plainEvent
+		Duration float64 `json:"duration,omitempty"`
+	}{plainEvent(event), event.Duration.Seconds()})
+}
+
+// Reporter defines the interface for presenting the Events of an Executor
+type Reporter interface {
+	Report(event Event)
+}
+
+// newStepEvent creates an Event describing the specified Step
+func newStepEvent(eventType EventType, s step.Step) Event {
+	event := Event{
+		Type:    eventType,
+		Name:    s.GetMeta().Name,
+		Label:   s.GetActivityLabel(),
+		Details: s.GetActivityDetails(),
+	}
+
+	switch typed := s.(type) {
+	case step.LinkStep:
+		event.Step, event.Source, event.Target = "link", typed.Source, typed.Target
+	case step.DirectoryStep:
+		event.Step, event.Target = "directory", typed.Target
+	case step.ShellStep:
+		event.Step = "shell"
+	case step.CleanStep:
+		event.Step, event.Target = "clean", typed.Target
+	case step.TemplateStep:
+		event.Step, event.Source, event.Target = "template", typed.Source, typed.Target
+	case step.CopyStep:
+		event.Step, event.Source, event.Target = "copy", typed.Source, typed.Target
+	case step.GitStep:
+		event.Step, event.Source, event.Target = "git", typed.URL, typed.Target
+	case step.ExtractStep:
+		event.Step, event.Source, event.Target = "extract", typed.Source, typed.Target
+	case step.LineInFileStep:
+		event.Step, event.Target = "lineinfile", typed.Target
+	case step.BlockInFileStep:
+		event.Step, event.Target = "blockinfile", typed.Target
+	}
+
+	return event
+}
+
+var (
+	cYellow  = color.New(color.FgYellow).SprintFunc()
+	cbYellow = color.New(color.FgYellow, color.Bold).SprintFunc()
+	cGreen   = color.New(color.FgGreen).SprintFunc()
+	cbGreen  = color.New(color.FgGreen, color.Bold).SprintFunc()
+	cbRed    = color.New(color.FgRed, color.Bold).SprintFunc()
+	cbCyan   = color.New(color.FgCyan, color.Bold).SprintFunc()
+	cRed     = color.New(color.FgRed).SprintFunc()
+	cCyan    = color.New(color.FgCyan).SprintFunc()
+
+	changeColors = map[step.ChangeType]func(a ...interface{}) string{
+		step.ChangeCreate:  cGreen,
+		step.ChangeUpdate:  cYellow,
+		step.ChangeReplace: cRed,
+		step.ChangeRemove:  cRed,
+		step.ChangeRun:     cCyan,
+	}
+)
+
+// TextReporter presents Events as colored, human-readable text
+type TextReporter struct {
+	writer io.Writer
+}
+
+// NewTextReporter creates a new instance of a TextReporter that writes to the specified Writer
+func NewTextReporter(writer io.Writer) TextReporter {
+	return TextReporter{writer: writer}
+}
+
+func (reporter TextReporter) output(format string, a ...interface{}) {
+	fmt.Fprintf(reporter.writer, format, a...)
+}
+
+func (reporter TextReporter) outputIndented(colorize func(a ...interface{}) string, message string) {
+	for _, line := range indentString(message) {
+		reporter.output("%s\n", colorize(line))
+	}
+}
+
+// Report writes the Event as text
+func (reporter TextReporter) Report(event Event) {
+	switch event.Type {
+	case EventStart:
+		reporter.reportStart(event)
+
+	case EventStep:
+		reporter.output(
+			cGreen("%s: %s\n"),
+			event.Label,
+			cbGreen(event.Details),
+		)
+
+	case EventSkip:
+		reporter.output(
+			cYellow("Skipped: %s %s (%s)\n"),
+			event.Label,
+			cbYellow(event.Details),
+			event.Reason,
+		)
+
+	case EventPlan:
+		for _, change := range event.Changes {
+			colorize := changeColors[change.Type]
+			reporter.output(
+				"    %s %s\n",
+				colorize(change.Type.Symbol()),
+				colorize(change.Description),
+			)
+		}
+
+	case EventResult:
+		if event.Error != "" {
+			reporter.output(
+				cbRed("Failed: %s %s\n"),
+				event.Label,
+				event.Details,
+			)
+			reporter.outputIndented(cRed, event.Error)
+		} else if event.Status == step.ResultUnchanged.String() {
+			reporter.output("    %s\n", cGreen("ok: "+event.Message))
+		} else if event.Status != "" {
+			reporter.output("    %s\n", cYellow("changed: "+event.Message))
+		}
+
+	case EventBackup:
+		reporter.outputIndented(cbCyan, fmt.Sprintf("Backed up %s to %s", event.Source, event.Target))
+
+	case EventRestore:
+		reporter.outputIndented(cbCyan, fmt.Sprintf("Restored %s from %s", event.Target, event.Source))
+
+	case EventOrphan:
+		reporter.output(
+			cGreen("Orphaned: %s\n"),
+			cbGreen(event.Target),
+		)
+		reporter.outputIndented(cbCyan, event.Message)
+
+	case EventInfo:
+		reporter.outputIndented(cbCyan, event.Message)
+
+	case EventError:
+		reporter.outputIndented(cbRed, event.Message)
+
+	case EventComplete:
+		if event.Summary != nil {
+			colorize := cbYellow
+			if event.Summary.Failed > 0 {
+				colorize = cbRed
+			}
+			reporter.output(colorize(fmt.Sprintf(
+				"Complete: %d changed, %d ok, %d skipped, %d failed.\n",
+				event.Summary.Changed,
+				event.Summary.Unchanged,
+				event.Summary.Skipped,
+				event.Summary.Failed,
+			)))
+		} else if event.Action != "status" {
+			reporter.output(cbYellow("Complete.\n"))
+		} else if event.Drift > 0 {
+			reporter.output(cbRed("Drift detected in %d step(s).\n"), event.Drift)
+		} else {
+			reporter.output(cbYellow("No drift detected.\n"))
+		}
+	}
+}
+
+func (reporter TextReporter) reportStart(event Event) {
+	switch {
+	case event.Action == "status":
+		reporter.output(
+			cYellow("Checking %s against %s\n"),
+			cbYellow(event.Target),
+			cbYellow(event.Source),
+		)
+	case event.Action == "uninstall":
+		reporter.output(
+			cYellow("Uninstalling %s from %s\n"),
+			cbYellow(event.Source),
+			cbYellow(event.Target),
+		)
+	case event.DryRun:
+		reporter.output(
+			cYellow("Planning installation of %s to %s (dry run)\n"),
+			cbYellow(event.Source),
+			cbYellow(event.Target),
+		)
+	default:
+		reporter.output(
+			cYellow("Installing %s to %s\n"),
+			cbYellow(event.Source),
+			cbYellow(event.Target),
+		)
+	}
+
+	if event.Config != "" {
+		reporter.output(
+			cYellow("Using %s\n"),
+			cbYellow(event.Config),
+		)
+	}
+}
+
+func indentString(value string) []string {
+	lines := strings.Split(value, "\n")
+	indented := make([]string, 0, len(lines))
+
+	for idx, line := range lines {
+		if line == "" && idx == (len(lines)-1) {
+			break
+		}
+		indented = append(indented, "    "+line)
+	}
+
+	return indented
+}
+
+// bufferedReporter holds on to Events until they are flushed to another Reporter
+type bufferedReporter struct {
+	events []Event
+	mutex  sync.Mutex
+}
+
+func (reporter *bufferedReporter) Report(event Event) {
+	reporter.mutex.Lock()
+	defer reporter.mutex.Unlock()
+	reporter.events = append(reporter.events, event)
+}
+
+func (reporter *bufferedReporter) flush(destination Reporter) {
+	for _, event := range reporter.events {
+		destination.Report(event)
+	}
+	reporter.events = nil
+}
+
+// JSONReporter presents Events as JSON objects, one per line
+type JSONReporter struct {
+	encoder *json.Encoder
+	mutex   *sync.Mutex
+}
+
+// NewJSONReporter creates a new instance of a JSONReporter that writes to the specified Writer
+func NewJSONReporter(writer io.Writer) JSONReporter {
+	return JSONReporter{
+		encoder: json.NewEncoder(writer),
+		mutex:   &sync.Mutex{},
+	}
+}
+
+// Report writes the Event as a line of JSON
+func (reporter JSONReporter) Report(event Event) {
+	reporter.mutex.Lock()
+	defer reporter.mutex.Unlock()
+
+	// Events are built from values we control, so they always encode
+	_ = reporter.encoder.Encode(event)
+}
@@ -0,0 +1,123 @@
+package dotter_test
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	"github.com/jayclassless/dotter"
+)
+
+var _ = Describe("Reporter", func() {
+	var sourceDir string
+	var targetDir string
+	var output bytes.Buffer
+
+	BeforeEach(func() {
+		sourceDir = tmpdir()
+		targetDir = tmpdir()
+		output.Reset()
+	})
+
+	AfterEach(func() {
+		rmdir(sourceDir)
+		rmdir(targetDir)
+	})
+
+	run := func(content string, dryRun bool) []map[string]interface{} {
+		cfg, err := dotter.NewConfigurationFromYaml([]byte(content))
+		Expect(err).Should(Succeed())
+		cfg.Options.DryRun = dryRun
+		exec := dotter.NewExecutor(sourceDir, targetDir, cfg)
+		exec.Reporter = dotter.NewJSONReporter(&output)
+		exec.Execute()
+
+		events := make([]map[string]interface{}, 0)
+		scanner := bufio.NewScanner(&output)
+		for scanner.Scan() {
+			event := make(map[string]interface{})
+			Expect(json.Unmarshal(scanner.Bytes(), &event)).Should(Succeed())
+			events = append(events, event)
+		}
+		return events
+	}
+
+	types := func(events []map[string]interface{}) []string {
+		found := make([]string, 0, len(events))
+		for _, event := range events {
+			found = append(found, event["event"].(string))
+		}
+		return found
+	}
+
+	It("Reports each step as a line of JSON", func() {
+		writeFile(sourceDir, "foo", "foo")
+
+		events := run(`
+steps:
+  - link:
+      .foo: foo
+  - directory:
+    - bar
+    when:
+      os: plan9
+`, false)
+
+		Expect(types(events)).To(Equal([]string{"start", "step", "result", "skip", "complete"}))
+		Expect(events[0]["action"]).To(Equal("install"))
+		Expect(events[1]["step"]).To(Equal("link"))
+		Expect(events[1]["source"]).To(Equal("foo"))
+		Expect(events[1]["target"]).To(Equal(".foo"))
+		Expect(events[2]).To(HaveKey("duration"))
+		Expect(events[2]).NotTo(HaveKey("error"))
+		Expect(events[2]["status"]).To(Equal("created"))
+		Expect(events[3]["step"]).To(Equal("directory"))
+		Expect(events[3]["reason"]).To(HavePrefix("OS is"))
+	})
+
+	It("Reports errors and backups", func() {
+		writeFile(sourceDir, "foo", "foo")
+		writeFile(targetDir, ".foo", "mine")
+
+		events := run(`
+options:
+  backupforced: .backup
+  stoponerror: false
+steps:
+  - link:
+      .foo:
+        source: foo
+        force: true
+  - shell:
+    - exit 3
+`, false)
+
+		Expect(types(events)).To(Equal([]string{"start", "step", "backup", "result", "step", "result", "complete"}))
+		Expect(events[2]["source"]).To(HaveSuffix(".foo"))
+		Expect(events[2]["target"]).To(ContainSubstring(".backup"))
+		Expect(events[5]["error"]).To(ContainSubstring("exit status 3"))
+		Expect(events[6]["summary"]).To(Equal(map[string]interface{}{
+			"changed":   1.0,
+			"unchanged": 0.0,
+			"skipped":   0.0,
+			"failed":    1.0,
+		}))
+	})
+
+	It("Reports planned changes", func() {
+		events := run(`
+steps:
+  - directory:
+    - bar
+`, true)
+
+		Expect(types(events)).To(Equal([]string{"start", "step", "plan", "result", "complete"}))
+		Expect(events[0]["dry_run"]).To(BeTrue())
+		Expect(events[2]["changes"]).To(HaveLen(1))
+		change := events[2]["changes"].([]interface{})[0].(map[string]interface{})
+		Expect(change["type"]).To(Equal("create"))
+	})
+})
@@ -0,0 +1,148 @@
+package dotter
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	yaml "gopkg.in/yaml.v3"
+
+	"github.com/jayclassless/dotter/step"
+)
+
+// DefaultStateFile is the name of the state file kept in the target directory
+const DefaultStateFile = ".dotter_state.yaml"
+
+// TrackedBackup is the type of StateEntry recorded for backups made by ForceRemove
+const TrackedBackup = "backup"
+
+// StateEntry records something that dotter created
+type StateEntry struct {
+	Type   string
+	Path   string
+	Source string `yaml:",omitempty"`
+	Config string `yaml:",omitempty"`
+	Time   time.Time
+}
+
+// State keeps track of what dotter has created in a target directory across runs
+type State struct {
+	Path    string
+	Entries []StateEntry
+
+	mutex *sync.Mutex
+}
+
+// NewState creates a new, empty instance of a State struct that is stored at the specified path
+func NewState(path string) *State {
+	state := State{}
+	state.Path = path
+	state.Entries = make([]StateEntry, 0)
+	state.mutex = &sync.Mutex{}
+	return &state
+}
+
+type yamlState struct {
+	Entries []StateEntry
+}
+
+// Load reads the state file, if one exists
+func (state *State) Load() error {
+	state.mutex.Lock()
+	defer state.mutex.Unlock()
+
+	content, err := ioutil.ReadFile(state.Path)
+	if os.IsNotExist(err) {
+		state.Entries = make([]StateEntry, 0)
+		return nil
+	} else if err != nil {
+		return err
+	}
+
+	tmpState := yamlState{}
+	err = yaml.Unmarshal(content, &tmpState)
+	if err != nil {
+		return err
+	}
+
+	state.Entries = tmpState.Entries
+	if state.Entries == nil {
+		state.Entries = make([]StateEntry, 0)
+	}
+	return nil
+}
+
+// Save writes the state file
+func (state *State) Save() error {
+	state.mutex.Lock()
+	defer state.mutex.Unlock()
+
+	content, err := yaml.Marshal(yamlState{Entries: state.Entries})
+	if err != nil {
+		return err
+	}
+
+	err = os.MkdirAll(filepath.Dir(state.Path), os.FileMode(0o755))
+	if err != nil {
+		return err
+	}
+
+	return ioutil.WriteFile(state.Path, content, 0o644)
+}
+
+// Track records an entry, replacing any existing entry of the same type for the same path
+func (state *State) Track(entry StateEntry) {
+	state.mutex.Lock()
+	defer state.mutex.Unlock()
+
+	for idx, existing := range state.Entries {
+		if existing.Type == entry.Type && existing.Path == entry.Path {
+			state.Entries[idx] = entry
+			return
+		}
+	}
+	state.Entries = append(state.Entries, entry)
+}
+
+// Untrack removes all entries for the specified path
+func (state *State) Untrack(path string) {
+	state.mutex.Lock()
+	defer state.mutex.Unlock()
+
+	entries := make([]StateEntry, 0, len(state.Entries))
+	for _, entry := range state.Entries {
+		if entry.Path != path {
+			entries = append(entries, entry)
+		}
+	}
+	state.Entries = entries
+}
+
+// Find returns the entry of the specified type for the specified path, if there is one
+func (state *State) Find(entryType string, path string) (StateEntry, bool) {
+	state.mutex.Lock()
+	defer state.mutex.Unlock()
+
+	for _, entry := range state.Entries {
+		if entry.Type == entryType && entry.Path == path {
+			return entry, true
+		}
+	}
+	return StateEntry{}, false
+}
+
+// Links returns all of the entries that describe links
+func (state *State) Links() []StateEntry {
+	state.mutex.Lock()
+	defer state.mutex.Unlock()
+
+	links := make([]StateEntry, 0)
+	for _, entry := range state.Entries {
+		if entry.Type == step.TrackedLink {
+			links = append(links, entry)
+		}
+	}
+	return links
+}
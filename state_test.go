@@ -0,0 +1,61 @@
+package dotter_test
+
+import (
+	"path/filepath"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	"github.com/jayclassless/dotter"
+)
+
+var _ = Describe("State", func() {
+	var tmpDir string
+
+	BeforeEach(func() {
+		tmpDir = tmpdir()
+	})
+
+	AfterEach(func() {
+		rmdir(tmpDir)
+	})
+
+	It("Loads missing files as empty", func() {
+		state := dotter.NewState(filepath.Join(tmpDir, "state.yaml"))
+		Expect(state.Load()).Should(Succeed())
+		Expect(state.Entries).To(HaveLen(0))
+	})
+
+	It("Fails on bad files", func() {
+		writeFile(tmpDir, "state.yaml", "entries: foo")
+		state := dotter.NewState(filepath.Join(tmpDir, "state.yaml"))
+		Expect(state.Load()).ShouldNot(Succeed())
+	})
+
+	It("Saves and loads entries", func() {
+		state := dotter.NewState(filepath.Join(tmpDir, "sub", "state.yaml"))
+		state.Track(dotter.StateEntry{Type: "link", Path: "/foo", Source: "bar"})
+		state.Track(dotter.StateEntry{Type: "directory", Path: "/baz"})
+		Expect(state.Save()).Should(Succeed())
+
+		loaded := dotter.NewState(filepath.Join(tmpDir, "sub", "state.yaml"))
+		Expect(loaded.Load()).Should(Succeed())
+		Expect(loaded.Entries).To(HaveLen(2))
+		Expect(loaded.Links()).To(HaveLen(1))
+
+		entry, ok := loaded.Find("link", "/foo")
+		Expect(ok).To(BeTrue())
+		Expect(entry.Source).To(Equal("bar"))
+	})
+
+	It("Replaces entries for the same path", func() {
+		state := dotter.NewState(filepath.Join(tmpDir, "state.yaml"))
+		state.Track(dotter.StateEntry{Type: "link", Path: "/foo", Source: "bar"})
+		state.Track(dotter.StateEntry{Type: "link", Path: "/foo", Source: "baz"})
+		Expect(state.Entries).To(HaveLen(1))
+		Expect(state.Entries[0].Source).To(Equal("baz"))
+
+		state.Untrack("/foo")
+		Expect(state.Entries).To(HaveLen(0))
+	})
+})
@@ -1,17 +1,190 @@
 package step
 
+import "fmt"
+
 // StepExecutor defines the interface necessary to run Step.Execute()
 type StepExecutor interface {
 	GetTargetPath(path string) string
 	GetSourcePath(path string) string
 	ForceRemove(path string) error
+	RestoreBackup(path string) (bool, error)
+	Track(trackedType string, path string, source string)
+	Untrack(path string)
+	IsTracked(path string) bool
+	FindTracked(trackedType string, path string) (string, bool)
 	PrintInfo(message string)
 	PrintError(message string)
 }
 
+const (
+	// TrackedLink is the type used when tracking a symlink created by a Step
+	TrackedLink = "link"
+	// TrackedDirectory is the type used when tracking a directory created by a Step
+	TrackedDirectory = "directory"
+	// TrackedFile is the type used when tracking a regular file written by a Step
+	TrackedFile = "file"
+	// TrackedRun is the type used when tracking the checksum of a command run by a Step
+	TrackedRun = "run"
+)
+
 // Step defines the interface necessary for an installation step
 type Step interface {
 	GetActivityLabel() string
 	GetActivityDetails() string
-	Execute(StepExecutor) error
+	GetMeta() StepMeta
+	Plan(StepExecutor) ([]Change, error)
+	Execute(StepExecutor) (Result, error)
+}
+
+// StepMeta contains the options that are common to all Step types
+type StepMeta struct {
+	Name      string
+	DependsOn StringList `yaml:"depends_on"`
+	When      Conditions
+	OnlyIf    string `yaml:"only_if"`
+	Tags      StringList
+	Parallel  *bool
+}
+
+// GetMeta returns the options that are common to all Step types
+func (meta StepMeta) GetMeta() StepMeta {
+	return meta
+}
+
+// HasTag indicates whether or not the Step has been given any of the specified tags
+func (meta StepMeta) HasTag(tags ...string) bool {
+	for _, tag := range tags {
+		if contains(meta.Tags, tag) {
+			return true
+		}
+	}
+	return false
+}
+
+// Check evaluates the conditions of the Step and its only_if command,
+// returning whether or not they all pass and, if they don't, the reason why
+func (meta StepMeta) Check(exec StepExecutor) (bool, string) {
+	if ok, reason := meta.When.Check(exec); !ok {
+		return false, reason
+	}
+	if meta.OnlyIf != "" && !runTest(exec, meta.OnlyIf) {
+		return false, fmt.Sprintf("only_if \"%s\" failed", meta.OnlyIf)
+	}
+	return true, ""
+}
+
+// Uninstaller defines the interface for Steps whose effects can be reversed
+type Uninstaller interface {
+	Uninstall(StepExecutor) error
+}
+
+// ChangeType categorizes the modifications that a Step can make
+type ChangeType int
+
+const (
+	// ChangeCreate indicates something will be created
+	ChangeCreate ChangeType = iota
+	// ChangeUpdate indicates something existing will be modified
+	ChangeUpdate
+	// ChangeReplace indicates something existing will be removed and replaced
+	ChangeReplace
+	// ChangeRemove indicates something existing will be removed
+	ChangeRemove
+	// ChangeRun indicates a command will be executed
+	ChangeRun
+)
+
+// Symbol returns the diff-like marker used when displaying a ChangeType
+func (changeType ChangeType) Symbol() string {
+	switch changeType {
+	case ChangeCreate:
+		return "+"
+	case ChangeUpdate:
+		return "~"
+	case ChangeReplace:
+		return "!"
+	case ChangeRemove:
+		return "-"
+	}
+	return ">"
+}
+
+// String returns the name of the ChangeType
+func (changeType ChangeType) String() string {
+	switch changeType {
+	case ChangeCreate:
+		return "create"
+	case ChangeUpdate:
+		return "update"
+	case ChangeReplace:
+		return "replace"
+	case ChangeRemove:
+		return "remove"
+	}
+	return "run"
+}
+
+// MarshalText encodes the ChangeType as its name
+func (changeType ChangeType) MarshalText() ([]byte, error) {
+	return []byte(changeType.String()), nil
+}
+
+// Change describes a single modification that a Step would make
+type Change struct {
+	Type        ChangeType `json:"type"`
+	Description string     `json:"description"`
+}
+
+// NewChange creates a new instance of a Change struct
+func NewChange(changeType ChangeType, format string, a ...interface{}) Change {
+	return Change{
+		Type:        changeType,
+		Description: fmt.Sprintf(format, a...),
+	}
+}
+
+// ResultStatus categorizes what a Step did when it was executed
+type ResultStatus int
+
+const (
+	// ResultUnchanged indicates nothing needed to be done
+	ResultUnchanged ResultStatus = iota
+	// ResultCreated indicates something was created
+	ResultCreated
+	// ResultUpdated indicates something existing was modified
+	ResultUpdated
+	// ResultReplaced indicates something existing was removed and replaced
+	ResultReplaced
+)
+
+// String returns the name of the ResultStatus
+func (status ResultStatus) String() string {
+	switch status {
+	case ResultCreated:
+		return "created"
+	case ResultUpdated:
+		return "updated"
+	case ResultReplaced:
+		return "replaced"
+	}
+	return "unchanged"
+}
+
+// Changed indicates whether or not the ResultStatus represents a modification
+func (status ResultStatus) Changed() bool {
+	return status != ResultUnchanged
+}
+
+// Result describes what a Step did when it was executed
+type Result struct {
+	Status  ResultStatus
+	Message string
+}
+
+// NewResult creates a new instance of a Result struct
+func NewResult(status ResultStatus, format string, a ...interface{}) Result {
+	return Result{
+		Status:  status,
+		Message: fmt.Sprintf(format, a...),
+	}
 }
@@ -0,0 +1,50 @@
+package step_test
+
+import (
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	"github.com/jayclassless/dotter/step"
+)
+
+var _ = Describe("StepMeta", func() {
+	Describe("HasTag", func() {
+		It("Works", func() {
+			meta := step.StepMeta{Tags: step.StringList{"work", "common"}}
+			Expect(meta.HasTag("personal", "common")).To(BeTrue())
+			Expect(meta.HasTag("personal")).To(BeFalse())
+			Expect(meta.HasTag()).To(BeFalse())
+		})
+	})
+
+	Describe("Check", func() {
+		It("Runs the only_if command after the conditions", func() {
+			executor := NewTestExecutor(tmpdir(), tmpdir())
+			defer rmdir(executor.target)
+			defer rmdir(executor.source)
+
+			ok, _ := step.StepMeta{OnlyIf: "true"}.Check(executor)
+			Expect(ok).To(BeTrue())
+
+			ok, reason := step.StepMeta{OnlyIf: "false"}.Check(executor)
+			Expect(ok).To(BeFalse())
+			Expect(reason).To(Equal("only_if \"false\" failed"))
+
+			ok, reason = step.StepMeta{When: step.Conditions{OS: step.StringList{"plan9"}}, OnlyIf: "true"}.Check(executor)
+			Expect(ok).To(BeFalse())
+			Expect(reason).To(HavePrefix("OS is"))
+		})
+	})
+})
+
+var _ = Describe("ChangeType", func() {
+	Describe("Symbol", func() {
+		It("Works", func() {
+			Expect(step.ChangeCreate.Symbol()).To(Equal("+"))
+			Expect(step.ChangeUpdate.Symbol()).To(Equal("~"))
+			Expect(step.ChangeReplace.Symbol()).To(Equal("!"))
+			Expect(step.ChangeRemove.Symbol()).To(Equal("-"))
+			Expect(step.ChangeRun.Symbol()).To(Equal(">"))
+		})
+	})
+})
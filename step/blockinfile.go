@@ -0,0 +1,132 @@
+package step
+
+import (
+	"fmt"
+	"strings"
+)
+
+// BlockInFileOptions contains non-content options for BlockInFile steps
+type BlockInFileOptions struct {
+	Create bool
+	State  string
+	Marker string
+}
+
+// NewBlockInFileOptions creates a new instance of a BlockInFileOptions struct
+func NewBlockInFileOptions() BlockInFileOptions {
+	opt := BlockInFileOptions{}
+	opt.Create = true
+	opt.State = "present"
+	opt.Marker = "# {mark} DOTTER MANAGED BLOCK"
+	return opt
+}
+
+// BlockInFileStep contains the specification for BlockInFile steps
+type BlockInFileStep struct {
+	BlockInFileOptions `yaml:",inline"`
+	StepMeta           `yaml:",inline"`
+	Target             string
+	Block              string
+	InsertBefore       string `yaml:"insert_before"`
+	InsertAfter        string `yaml:"insert_after"`
+}
+
+// NewBlockInFileStep creates a new instance of a BlockInFileStep struct using default options
+func NewBlockInFileStep() BlockInFileStep {
+	return NewBlockInFileStepWithDefaults(NewBlockInFileOptions())
+}
+
+// NewBlockInFileStepWithDefaults creates a new instance of a BlockInFileStep struct using the specified options
+func NewBlockInFileStepWithDefaults(defaults BlockInFileOptions) BlockInFileStep {
+	step := BlockInFileStep{}
+	step.BlockInFileOptions = defaults
+	return step
+}
+
+// GetActivityLabel returns a short description of what a BlockInFileStep does
+func (step BlockInFileStep) GetActivityLabel() string {
+	return "Editing"
+}
+
+// GetActivityDetails returns description specific to this particular instance of the BlockInFileStep
+func (step BlockInFileStep) GetActivityDetails() string {
+	return step.Target
+}
+
+// getMarkers returns the lines that surround the block
+func (step BlockInFileStep) getMarkers() (string, string, error) {
+	if !strings.Contains(step.Marker, "{mark}") {
+		return "", "", fmt.Errorf("Marker \"%s\" does not contain {mark}", step.Marker)
+	}
+	return strings.Replace(step.Marker, "{mark}", "BEGIN", -1),
+		strings.Replace(step.Marker, "{mark}", "END", -1),
+		nil
+}
+
+// findBlock returns the indexes of the lines that start and end the block, or
+// -1 if it isn't there
+func (step BlockInFileStep) findBlock(lines []string, begin string, end string) (int, int, error) {
+	for start, line := range lines {
+		if strings.TrimSpace(line) != begin {
+			continue
+		}
+		for finish := start + 1; finish < len(lines); finish++ {
+			if strings.TrimSpace(lines[finish]) == end {
+				return start, finish, nil
+			}
+		}
+		return -1, -1, fmt.Errorf("Found \"%s\" without \"%s\" in %s", begin, end, step.Target)
+	}
+	return -1, -1, nil
+}
+
+func (step BlockInFileStep) edit(lines []string) (fileEdit, error) {
+	err := checkState(step.State)
+	if err != nil {
+		return fileEdit{}, err
+	}
+	begin, end, err := step.getMarkers()
+	if err != nil {
+		return fileEdit{}, err
+	}
+	start, finish, err := step.findBlock(lines, begin, end)
+	if err != nil {
+		return fileEdit{}, err
+	}
+
+	if step.State == "absent" {
+		if start < 0 {
+			return fileEdit{}, nil
+		}
+		edited := append(append([]string{}, lines[:start]...), lines[finish+1:]...)
+		return fileEdit{lines: edited, planned: "remove block", done: "removed block"}, nil
+	}
+
+	block := append(append([]string{begin}, splitLines(step.Block)...), end)
+
+	if start < 0 {
+		edited, err := insertLines(lines, block, step.InsertBefore, step.InsertAfter)
+		if err != nil {
+			return fileEdit{}, err
+		}
+		return fileEdit{lines: edited, planned: "insert block", done: "inserted block"}, nil
+	}
+
+	if strings.Join(lines[start:finish+1], "\n") == strings.Join(block, "\n") {
+		return fileEdit{}, nil
+	}
+	edited := append([]string{}, lines[:start]...)
+	edited = append(edited, block...)
+	edited = append(edited, lines[finish+1:]...)
+	return fileEdit{lines: edited, planned: "replace block", done: "replaced block"}, nil
+}
+
+// Plan describes the changes that Execute would make to the file
+func (step BlockInFileStep) Plan(exec StepExecutor) ([]Change, error) {
+	return planEdit(exec, step.Target, step.Create, step.edit)
+}
+
+// Execute makes sure the block is present in, or absent from, the file
+func (step BlockInFileStep) Execute(exec StepExecutor) (Result, error) {
+	return applyEdit(exec, step.Target, step.Create, step.edit)
+}
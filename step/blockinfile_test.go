@@ -0,0 +1,121 @@
+package step_test
+
+import (
+	"io/ioutil"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	"github.com/jayclassless/dotter/step"
+)
+
+var _ = Describe("BlockInFileStep", func() {
+	Describe("NewBlockInFileStep", func() {
+		It("Works", func() {
+			Expect(step.NewBlockInFileStep()).ShouldNot(BeNil())
+		})
+	})
+
+	Describe("GetActivityLabel", func() {
+		It("Works", func() {
+			Expect(step.NewBlockInFileStep().GetActivityLabel()).To(Equal("Editing"))
+		})
+	})
+
+	Describe("GetActivityDetails", func() {
+		It("Works", func() {
+			step := step.NewBlockInFileStep()
+			step.Target = "foobar"
+
+			Expect(step.GetActivityDetails()).To(Equal("foobar"))
+		})
+	})
+
+	Describe("Execute", func() {
+		var executor *TestExecutor
+
+		BeforeEach(func() {
+			executor = NewTestExecutor(tmpdir(), tmpdir())
+			mkdir(executor.target, ".ssh")
+			writeFile(executor.target, ".ssh/config", "Host work\n  User me\n\nHost *\n  AddKeysToAgent yes\n")
+		})
+
+		AfterEach(func() {
+			rmdir(executor.target)
+			rmdir(executor.source)
+		})
+
+		readTarget := func(path string) string {
+			content, err := ioutil.ReadFile(executor.GetTargetPath(path))
+			Expect(err).Should(Succeed())
+			return string(content)
+		}
+
+		It("Inserts, replaces and removes the block", func() {
+			s := step.NewBlockInFileStep()
+			s.Target = ".ssh/config"
+			s.Block = "Host github.com\n  User git\n"
+			s.InsertBefore = "^Host \\*"
+
+			changes, err := s.Plan(executor)
+			Expect(err).Should(Succeed())
+			Expect(changes).To(Equal([]step.Change{{
+				Type:        step.ChangeUpdate,
+				Description: "insert block in " + executor.GetTargetPath(".ssh/config"),
+			}}))
+
+			Expect(s.Execute(executor)).To(haveStatus("updated"))
+			Expect(readTarget(".ssh/config")).To(Equal(
+				"Host work\n  User me\n\n# BEGIN DOTTER MANAGED BLOCK\nHost github.com\n  User git\n# END DOTTER MANAGED BLOCK\nHost *\n  AddKeysToAgent yes\n",
+			))
+			Expect(s.Execute(executor)).To(haveStatus("unchanged"))
+
+			s.Block = "Host github.com\n  User git\n  IdentityFile ~/.ssh/github\n"
+			result, err := s.Execute(executor)
+			Expect(err).Should(Succeed())
+			Expect(result.Message).To(Equal("replaced block"))
+			Expect(readTarget(".ssh/config")).To(ContainSubstring("  IdentityFile ~/.ssh/github\n# END DOTTER MANAGED BLOCK\nHost *\n"))
+
+			s.State = "absent"
+			Expect(s.Execute(executor)).To(haveStatus("updated"))
+			Expect(readTarget(".ssh/config")).To(Equal("Host work\n  User me\n\nHost *\n  AddKeysToAgent yes\n"))
+			Expect(executor.backedUp).To(HaveLen(3))
+		})
+
+		It("Keeps blocks with different markers apart", func() {
+			s := step.NewBlockInFileStep()
+			s.Target = ".ssh/config"
+			s.Block = "Host one"
+			s.Marker = "# {mark} one"
+			Expect(s.Execute(executor)).To(haveStatus("updated"))
+
+			s.Block = "Host two"
+			s.Marker = "# {mark} two"
+			Expect(s.Execute(executor)).To(haveStatus("updated"))
+
+			Expect(readTarget(".ssh/config")).To(HaveSuffix(
+				"# BEGIN one\nHost one\n# END one\n# BEGIN two\nHost two\n# END two\n",
+			))
+		})
+
+		It("Fails on markers without a placeholder", func() {
+			s := step.NewBlockInFileStep()
+			s.Target = ".ssh/config"
+			s.Block = "Host one"
+			s.Marker = "# managed"
+
+			_, err := s.Execute(executor)
+			Expect(err).To(MatchError(ContainSubstring("does not contain {mark}")))
+		})
+
+		It("Fails on unterminated blocks", func() {
+			writeFile(executor.target, ".ssh/config", "# BEGIN DOTTER MANAGED BLOCK\nHost one\n")
+			s := step.NewBlockInFileStep()
+			s.Target = ".ssh/config"
+			s.Block = "Host one"
+
+			_, err := s.Execute(executor)
+			Expect(err).To(MatchError(ContainSubstring("without \"# END DOTTER MANAGED BLOCK\"")))
+		})
+	})
+})
@@ -1,12 +1,19 @@
 package step
 
-import "fmt"
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+)
 
+// CleanOptions contains non-path options for Clean steps
 type CleanOptions struct {
 	Force     bool
 	Recursive bool
 }
 
+// NewCleanOptions creates a new instance of a CleanOptions struct
 func NewCleanOptions() CleanOptions {
 	opt := CleanOptions{}
 	opt.Force = false
@@ -14,30 +21,124 @@ func NewCleanOptions() CleanOptions {
 	return opt
 }
 
+// CleanStep contains the specification for Clean steps
 type CleanStep struct {
 	CleanOptions `yaml:",inline"`
+	StepMeta     `yaml:",inline"`
 	Target       string `yaml:"path"`
 }
 
+// NewCleanStep creates a new instance of a CleanStep struct using default options
 func NewCleanStep() CleanStep {
 	return NewCleanStepWithDefaults(NewCleanOptions())
 }
 
+// NewCleanStepWithDefaults creates a new instance of a CleanStep struct using the specified options
 func NewCleanStepWithDefaults(defaults CleanOptions) CleanStep {
 	step := CleanStep{}
 	step.CleanOptions = defaults
 	return step
 }
 
+// GetActivityLabel returns a short description of what a CleanStep does
 func (step CleanStep) GetActivityLabel() string {
 	return "Cleaning"
 }
 
+// GetActivityDetails returns description specific to this particular instance of the CleanStep
 func (step CleanStep) GetActivityDetails() string {
 	return step.Target
 }
 
-func (step CleanStep) Execute(exec StepExecutor) error {
-	fmt.Printf("Cleaning %s\n", step.Target)
-	return nil
+// Plan describes the broken symlinks that Execute would remove
+func (step CleanStep) Plan(exec StepExecutor) ([]Change, error) {
+	links, err := step.findDeadLinks(exec)
+	if err != nil {
+		return nil, err
+	}
+
+	changes := make([]Change, 0, len(links))
+	for _, link := range links {
+		changes = append(changes, NewChange(ChangeRemove, "remove %s", link))
+	}
+
+	return changes, nil
+}
+
+// Execute removes the broken symlinks found in the specified directory
+func (step CleanStep) Execute(exec StepExecutor) (Result, error) {
+	links, err := step.findDeadLinks(exec)
+	if err != nil {
+		return Result{}, err
+	}
+
+	for _, link := range links {
+		err = os.Remove(link)
+		if err != nil {
+			return Result{}, err
+		}
+		exec.Untrack(link)
+		exec.PrintInfo(fmt.Sprintf("Removed %s", link))
+	}
+
+	if len(links) == 0 {
+		return NewResult(ResultUnchanged, "no broken links"), nil
+	}
+	return NewResult(ResultUpdated, "removed %d broken link(s)", len(links)), nil
+}
+
+func (step CleanStep) findDeadLinks(exec StepExecutor) ([]string, error) {
+	targetPath := exec.GetTargetPath(step.Target)
+	sourcePath := exec.GetSourcePath("")
+	links := make([]string, 0)
+
+	check := func(path string, fileInfo os.FileInfo) {
+		if !IsSymLink(fileInfo) {
+			return
+		}
+		if step.isDeadLink(exec, path, sourcePath) {
+			links = append(links, path)
+		}
+	}
+
+	if step.Recursive {
+		err := filepath.Walk(targetPath, func(path string, fileInfo os.FileInfo, err error) error {
+			if err != nil {
+				return err
+			}
+			check(path, fileInfo)
+			return nil
+		})
+		return links, err
+	}
+
+	fileInfos, err := ioutil.ReadDir(targetPath)
+	if err != nil {
+		return nil, err
+	}
+	for _, fileInfo := range fileInfos {
+		check(filepath.Join(targetPath, fileInfo.Name()), fileInfo)
+	}
+
+	return links, nil
+}
+
+func (step CleanStep) isDeadLink(exec StepExecutor, path string, sourcePath string) bool {
+	if _, err := os.Stat(path); !os.IsNotExist(err) {
+		return false
+	}
+
+	if step.Force || exec.IsTracked(path) {
+		return true
+	}
+
+	destination, err := os.Readlink(path)
+	if err != nil {
+		return false
+	}
+	if !filepath.IsAbs(destination) {
+		destination = filepath.Join(filepath.Dir(path), destination)
+	}
+
+	return IsWithin(destination, sourcePath)
 }
@@ -0,0 +1,174 @@
+package step_test
+
+import (
+	"os"
+	"path/filepath"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	"github.com/jayclassless/dotter/step"
+)
+
+var _ = Describe("CleanStep", func() {
+	Describe("NewCleanStep", func() {
+		It("Works", func() {
+			Expect(step.NewCleanStep()).ShouldNot(BeNil())
+		})
+	})
+
+	Describe("GetActivityLabel", func() {
+		It("Works", func() {
+			Expect(step.NewCleanStep().GetActivityLabel()).To(Equal("Cleaning"))
+		})
+	})
+
+	Describe("GetActivityDetails", func() {
+		It("Works", func() {
+			step := step.NewCleanStep()
+			step.Target = "foobar"
+
+			Expect(step.GetActivityDetails()).To(Equal("foobar"))
+		})
+	})
+
+	Describe("Plan", func() {
+		It("Works", func() {
+			executor := NewTestExecutor(tmpdir(), tmpdir())
+			defer rmdir(executor.target)
+			defer rmdir(executor.source)
+			ln(executor.GetTargetPath("dead"), executor.GetSourcePath("dead"))
+
+			changes, err := step.NewCleanStep().Plan(executor)
+			Expect(err).Should(Succeed())
+			Expect(changes).To(Equal([]step.Change{
+				{Type: step.ChangeRemove, Description: "remove " + executor.GetTargetPath("dead")},
+			}))
+
+			_, err = os.Lstat(executor.GetTargetPath("dead"))
+			Expect(err).Should(Succeed())
+		})
+	})
+
+	Describe("Execute", func() {
+		var executor *TestExecutor
+		var outside string
+
+		BeforeEach(func() {
+			executor = NewTestExecutor(tmpdir(), tmpdir())
+			outside = tmpdir()
+		})
+
+		AfterEach(func() {
+			rmdir(executor.target)
+			rmdir(executor.source)
+			rmdir(outside)
+		})
+
+		exists := func(path string) bool {
+			_, err := os.Lstat(executor.GetTargetPath(path))
+			return err == nil
+		}
+
+		It("Removes dead links into the source", func() {
+			writeFile(executor.source, "alive", "alive")
+			ln(executor.GetTargetPath("alive"), executor.GetSourcePath("alive"))
+			ln(executor.GetTargetPath("dead"), executor.GetSourcePath("dead"))
+			writeFile(executor.target, "regular", "regular")
+
+			s := step.NewCleanStep()
+			result, err := s.Execute(executor)
+			Expect(err).Should(Succeed())
+			Expect(result).To(haveStatus("updated"))
+
+			Expect(exists("alive")).To(BeTrue())
+			Expect(exists("dead")).To(BeFalse())
+			Expect(exists("regular")).To(BeTrue())
+			Expect(executor.infoLog).To(HaveLen(1))
+			Expect(executor.infoLog[0]).To(ContainSubstring(executor.GetTargetPath("dead")))
+		})
+
+		It("Removes relative dead links into the source", func() {
+			rel, _ := filepath.Rel(executor.target, executor.GetSourcePath("dead"))
+			ln(executor.GetTargetPath("dead"), rel)
+
+			s := step.NewCleanStep()
+			_, err := s.Execute(executor)
+			Expect(err).Should(Succeed())
+			Expect(exists("dead")).To(BeFalse())
+		})
+
+		It("Leaves dead links outside the source", func() {
+			ln(executor.GetTargetPath("dead"), filepath.Join(outside, "dead"))
+
+			s := step.NewCleanStep()
+			result, err := s.Execute(executor)
+			Expect(err).Should(Succeed())
+			Expect(result).To(haveStatus("unchanged"))
+			Expect(exists("dead")).To(BeTrue())
+			Expect(executor.infoLog).To(HaveLen(0))
+		})
+
+		It("Removes dead links outside the source when Force is enabled", func() {
+			ln(executor.GetTargetPath("dead"), filepath.Join(outside, "dead"))
+
+			s := step.NewCleanStep()
+			s.Force = true
+			_, err := s.Execute(executor)
+			Expect(err).Should(Succeed())
+			Expect(exists("dead")).To(BeFalse())
+		})
+
+		It("Removes tracked dead links outside the source", func() {
+			ln(executor.GetTargetPath("dead"), filepath.Join(outside, "dead"))
+			executor.Track(step.TrackedLink, executor.GetTargetPath("dead"), filepath.Join(outside, "dead"))
+
+			s := step.NewCleanStep()
+			_, err := s.Execute(executor)
+			Expect(err).Should(Succeed())
+			Expect(exists("dead")).To(BeFalse())
+			Expect(executor.tracked).To(HaveLen(0))
+		})
+
+		It("Ignores subdirectories", func() {
+			mkdir(executor.target, "sub")
+			ln(executor.GetTargetPath("sub/dead"), executor.GetSourcePath("dead"))
+
+			s := step.NewCleanStep()
+			_, err := s.Execute(executor)
+			Expect(err).Should(Succeed())
+			Expect(exists("sub/dead")).To(BeTrue())
+		})
+
+		It("Scans subdirectories when Recursive is enabled", func() {
+			mkdir(executor.target, "sub")
+			ln(executor.GetTargetPath("sub/dead"), executor.GetSourcePath("dead"))
+
+			s := step.NewCleanStep()
+			s.Recursive = true
+			_, err := s.Execute(executor)
+			Expect(err).Should(Succeed())
+			Expect(exists("sub/dead")).To(BeFalse())
+		})
+
+		It("Scans the specified path", func() {
+			mkdir(executor.target, "sub")
+			ln(executor.GetTargetPath("sub/dead"), executor.GetSourcePath("dead"))
+			ln(executor.GetTargetPath("dead"), executor.GetSourcePath("dead"))
+
+			s := step.NewCleanStep()
+			s.Target = "sub"
+			_, err := s.Execute(executor)
+			Expect(err).Should(Succeed())
+			Expect(exists("sub/dead")).To(BeFalse())
+			Expect(exists("dead")).To(BeTrue())
+		})
+
+		It("Fails on missing paths", func() {
+			s := step.NewCleanStep()
+			s.Target = "missing"
+			_, err := s.Execute(executor)
+			Expect(err).Should(HaveOccurred())
+		})
+	})
+})
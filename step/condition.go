@@ -0,0 +1,152 @@
+package step
+
+import (
+	"fmt"
+	"os"
+	osexec "os/exec"
+	"path/filepath"
+	"runtime"
+	"strings"
+
+	yaml "gopkg.in/yaml.v3"
+)
+
+// StringList is a list of strings that can be specified in YAML as either a
+// single string or a sequence of strings
+type StringList []string
+
+// UnmarshalYAML decodes a StringList from either a scalar or a sequence
+func (list *StringList) UnmarshalYAML(node *yaml.Node) error {
+	if node.Kind == yaml.ScalarNode {
+		*list = StringList{node.Value}
+		return nil
+	}
+
+	values := make([]string, 0)
+	err := node.Decode(&values)
+	if err != nil {
+		return err
+	}
+	*list = values
+	return nil
+}
+
+// Union returns the values from both lists, without duplicates
+func (list StringList) Union(other StringList) StringList {
+	union := make(StringList, 0, len(list)+len(other))
+	for _, value := range append(append(StringList{}, list...), other...) {
+		if !contains(union, value) {
+			union = append(union, value)
+		}
+	}
+	return union
+}
+
+// Conditions restricts the circumstances under which a Step is executed
+type Conditions struct {
+	OS       StringList `yaml:"os"`
+	Arch     StringList
+	Hostname StringList
+	Env      StringList
+	Command  StringList
+	Test     string
+}
+
+// conditionKeys are the conditions that can be specified in a when block
+var conditionKeys = map[string]bool{
+	"os":       true,
+	"arch":     true,
+	"hostname": true,
+	"env":      true,
+	"command":  true,
+	"test":     true,
+}
+
+// UnmarshalYAML decodes Conditions, rejecting keys that aren't conditions so
+// that a typo doesn't quietly make a step run everywhere
+func (cond *Conditions) UnmarshalYAML(node *yaml.Node) error {
+	if node.Kind == yaml.MappingNode {
+		for i := 0; i < len(node.Content); i += 2 {
+			key := node.Content[i]
+			if !conditionKeys[key.Value] {
+				return fmt.Errorf("Unknown condition \"%s\" at line %d", key.Value, key.Line)
+			}
+		}
+	}
+
+	type plainConditions Conditions
+	return node.Decode((*plainConditions)(cond))
+}
+
+// IsEmpty indicates whether or not any conditions have been specified
+func (cond Conditions) IsEmpty() bool {
+	return len(cond.OS) == 0 &&
+		len(cond.Arch) == 0 &&
+		len(cond.Hostname) == 0 &&
+		len(cond.Env) == 0 &&
+		len(cond.Command) == 0 &&
+		cond.Test == ""
+}
+
+// Check evaluates the conditions, returning whether or not they all pass and,
+// if they don't, the reason why
+func (cond Conditions) Check(exec StepExecutor) (bool, string) {
+	if len(cond.OS) > 0 && !contains(cond.OS, runtime.GOOS) {
+		return false, fmt.Sprintf("OS is %s", runtime.GOOS)
+	}
+
+	if len(cond.Arch) > 0 && !contains(cond.Arch, runtime.GOARCH) {
+		return false, fmt.Sprintf("architecture is %s", runtime.GOARCH)
+	}
+
+	if len(cond.Hostname) > 0 {
+		hostname, _ := os.Hostname()
+		if !matchesAny(cond.Hostname, hostname) {
+			return false, fmt.Sprintf("hostname is %s", hostname)
+		}
+	}
+
+	for _, name := range cond.Env {
+		if _, ok := os.LookupEnv(name); !ok {
+			return false, fmt.Sprintf("%s is not set", name)
+		}
+	}
+
+	for _, command := range cond.Command {
+		if _, err := osexec.LookPath(command); err != nil {
+			return false, fmt.Sprintf("%s is not on the PATH", command)
+		}
+	}
+
+	if cond.Test != "" && !runTest(exec, cond.Test) {
+		return false, fmt.Sprintf("test \"%s\" failed", cond.Test)
+	}
+
+	return true, ""
+}
+
+// runTest runs the shell command in the target directory, returning whether
+// or not it succeeded
+func runTest(exec StepExecutor, command string) bool {
+	cmd := osexec.Command(getShell(), "-c", command)
+	cmd.Dir = exec.GetTargetPath("")
+	return cmd.Run() == nil
+}
+
+func contains(values []string, value string) bool {
+	for _, candidate := range values {
+		if strings.EqualFold(candidate, value) {
+			return true
+		}
+	}
+	return false
+}
+
+func matchesAny(patterns []string, value string) bool {
+	for _, pattern := range patterns {
+		if matched, _ := filepath.Match(pattern, value); matched {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,118 @@
+package step_test
+
+import (
+	"os"
+	"runtime"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	yaml "gopkg.in/yaml.v3"
+
+	"github.com/jayclassless/dotter/step"
+)
+
+var _ = Describe("Conditions", func() {
+	var executor *TestExecutor
+
+	BeforeEach(func() {
+		executor = NewTestExecutor(tmpdir(), tmpdir())
+	})
+
+	AfterEach(func() {
+		rmdir(executor.target)
+		rmdir(executor.source)
+	})
+
+	Describe("UnmarshalYAML", func() {
+		It("Accepts single values and lists", func() {
+			cond := step.Conditions{}
+			err := yaml.Unmarshal([]byte("os: linux\narch: [amd64, arm64]\n"), &cond)
+			Expect(err).Should(Succeed())
+			Expect(cond.OS).To(Equal(step.StringList{"linux"}))
+			Expect(cond.Arch).To(Equal(step.StringList{"amd64", "arm64"}))
+		})
+
+		It("Rejects unknown conditions", func() {
+			cond := step.Conditions{}
+			err := yaml.Unmarshal([]byte("os: linux\nhostnme: laptop\n"), &cond)
+			Expect(err).To(MatchError("Unknown condition \"hostnme\" at line 2"))
+		})
+	})
+
+	Describe("Union", func() {
+		It("Works", func() {
+			list := step.StringList{"foo", "bar"}
+			Expect(list.Union(step.StringList{"bar", "baz"})).To(Equal(step.StringList{"foo", "bar", "baz"}))
+			Expect(list).To(Equal(step.StringList{"foo", "bar"}))
+		})
+	})
+
+	Describe("IsEmpty", func() {
+		It("Works", func() {
+			Expect(step.Conditions{}.IsEmpty()).To(BeTrue())
+			Expect(step.Conditions{Test: "true"}.IsEmpty()).To(BeFalse())
+		})
+	})
+
+	Describe("Check", func() {
+		It("Passes when empty", func() {
+			ok, _ := step.Conditions{}.Check(executor)
+			Expect(ok).To(BeTrue())
+		})
+
+		It("Checks the OS", func() {
+			ok, _ := step.Conditions{OS: step.StringList{"plan9", runtime.GOOS}}.Check(executor)
+			Expect(ok).To(BeTrue())
+
+			ok, reason := step.Conditions{OS: step.StringList{"plan9"}}.Check(executor)
+			Expect(ok).To(BeFalse())
+			Expect(reason).To(ContainSubstring(runtime.GOOS))
+		})
+
+		It("Checks the architecture", func() {
+			ok, _ := step.Conditions{Arch: step.StringList{runtime.GOARCH}}.Check(executor)
+			Expect(ok).To(BeTrue())
+
+			ok, _ = step.Conditions{Arch: step.StringList{"bogus"}}.Check(executor)
+			Expect(ok).To(BeFalse())
+		})
+
+		It("Checks the hostname", func() {
+			ok, _ := step.Conditions{Hostname: step.StringList{"*"}}.Check(executor)
+			Expect(ok).To(BeTrue())
+
+			ok, _ = step.Conditions{Hostname: step.StringList{"bogus-host-*"}}.Check(executor)
+			Expect(ok).To(BeFalse())
+		})
+
+		It("Checks environment variables", func() {
+			os.Setenv("DOTTER_TEST", "")
+			defer os.Unsetenv("DOTTER_TEST")
+
+			ok, _ := step.Conditions{Env: step.StringList{"DOTTER_TEST"}}.Check(executor)
+			Expect(ok).To(BeTrue())
+
+			ok, reason := step.Conditions{Env: step.StringList{"DOTTER_BOGUS"}}.Check(executor)
+			Expect(ok).To(BeFalse())
+			Expect(reason).To(Equal("DOTTER_BOGUS is not set"))
+		})
+
+		It("Checks commands", func() {
+			ok, _ := step.Conditions{Command: step.StringList{"sh"}}.Check(executor)
+			Expect(ok).To(BeTrue())
+
+			ok, _ = step.Conditions{Command: step.StringList{"dotter-bogus-command"}}.Check(executor)
+			Expect(ok).To(BeFalse())
+		})
+
+		It("Runs tests in the target", func() {
+			writeFile(executor.target, "foo", "foo")
+
+			ok, _ := step.Conditions{Test: "[ -f foo ]"}.Check(executor)
+			Expect(ok).To(BeTrue())
+
+			ok, _ = step.Conditions{Test: "[ -f bar ]"}.Check(executor)
+			Expect(ok).To(BeFalse())
+		})
+	})
+})
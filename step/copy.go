@@ -0,0 +1,334 @@
+package step
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+// CopyOptions contains non-path options for Copy steps
+type CopyOptions struct {
+	CreateParents bool `yaml:"create_parents"`
+	Force         bool
+}
+
+// NewCopyOptions creates a new instance of a CopyOptions struct
+func NewCopyOptions() CopyOptions {
+	opt := CopyOptions{}
+	opt.CreateParents = true
+	opt.Force = false
+	return opt
+}
+
+// CopyStep contains the specification for Copy steps
+type CopyStep struct {
+	CopyOptions `yaml:",inline"`
+	StepMeta    `yaml:",inline"`
+	Target      string
+	Source      string
+}
+
+// NewCopyStep creates a new instance of a CopyStep struct using default options
+func NewCopyStep() CopyStep {
+	return NewCopyStepWithDefaults(NewCopyOptions())
+}
+
+// NewCopyStepWithDefaults creates a new instance of a CopyStep struct using the specified options
+func NewCopyStepWithDefaults(defaults CopyOptions) CopyStep {
+	step := CopyStep{}
+	step.CopyOptions = defaults
+	return step
+}
+
+// GetActivityLabel returns a short description of what a CopyStep does
+func (step CopyStep) GetActivityLabel() string {
+	return "Copying"
+}
+
+// GetActivityDetails returns description specific to this particular instance of the CopyStep
+func (step CopyStep) GetActivityDetails() string {
+	return step.Target
+}
+
+type copyActionType int
+
+const (
+	copyCreate copyActionType = iota
+	copyUpdate
+	copyReplace
+	copyChmod
+)
+
+type copyAction struct {
+	actionType copyActionType
+	sourcePath string
+	targetPath string
+	isDir      bool
+	mode       os.FileMode
+}
+
+func (step CopyStep) inspect(exec StepExecutor) ([]copyAction, error) {
+	sourceRoot := exec.GetSourcePath(step.Source)
+	targetRoot := exec.GetTargetPath(step.Target)
+
+	_, err := os.Stat(sourceRoot)
+	if err != nil {
+		return nil, err
+	}
+
+	parentPath := filepath.Dir(targetRoot)
+	_, err = os.Stat(parentPath)
+	if os.IsNotExist(err) {
+		if !step.CreateParents {
+			return nil, fmt.Errorf(
+				"Cannot create %s as parent directory %s does not exist",
+				step.Target,
+				parentPath,
+			)
+		}
+	} else if err != nil {
+		return nil, err
+	}
+
+	actions := make([]copyAction, 0)
+	fresh := make(map[string]bool)
+
+	err = filepath.Walk(sourceRoot, func(sourcePath string, sourceInfo os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if IsSymLink(sourceInfo) {
+			sourceInfo, err = os.Stat(sourcePath)
+			if err != nil {
+				return err
+			}
+		}
+
+		rel, err := filepath.Rel(sourceRoot, sourcePath)
+		if err != nil {
+			return err
+		}
+		action := copyAction{
+			sourcePath: sourcePath,
+			targetPath: filepath.Join(targetRoot, rel),
+			isDir:      sourceInfo.IsDir(),
+			mode:       sourceInfo.Mode().Perm(),
+		}
+
+		if fresh[filepath.Dir(action.targetPath)] {
+			// The parent is being created, so everything inside it is too
+			action.actionType = copyCreate
+			actions = append(actions, action)
+			fresh[action.targetPath] = action.isDir
+			return nil
+		}
+
+		targetInfo, err := os.Lstat(action.targetPath)
+		if os.IsNotExist(err) {
+			action.actionType = copyCreate
+			actions = append(actions, action)
+			fresh[action.targetPath] = action.isDir
+			return nil
+		} else if err != nil {
+			return err
+		}
+
+		same, err := step.isSame(action, targetInfo)
+		if err != nil {
+			return err
+		}
+		if same {
+			if targetInfo.Mode().Perm() != action.mode {
+				action.actionType = copyChmod
+				actions = append(actions, action)
+			}
+			return nil
+		}
+
+		if !action.isDir && targetInfo.Mode().IsRegular() && exec.IsTracked(action.targetPath) {
+			action.actionType = copyUpdate
+			actions = append(actions, action)
+			return nil
+		}
+
+		if !step.Force {
+			return fmt.Errorf("%s already exists", action.targetPath)
+		}
+		action.actionType = copyReplace
+		actions = append(actions, action)
+		fresh[action.targetPath] = action.isDir
+		return nil
+	})
+
+	return actions, err
+}
+
+func (step CopyStep) isSame(action copyAction, targetInfo os.FileInfo) (bool, error) {
+	if action.isDir {
+		return targetInfo.IsDir(), nil
+	}
+	if !targetInfo.Mode().IsRegular() {
+		return false, nil
+	}
+
+	sourceSum, err := Checksum(action.sourcePath)
+	if err != nil {
+		return false, err
+	}
+	targetSum, err := Checksum(action.targetPath)
+	if err != nil {
+		return false, err
+	}
+
+	return sourceSum == targetSum, nil
+}
+
+// Plan describes the changes that Execute would make to copy the source
+func (step CopyStep) Plan(exec StepExecutor) ([]Change, error) {
+	actions, err := step.inspect(exec)
+	if err != nil {
+		return nil, err
+	}
+
+	changes := make([]Change, 0, len(actions))
+	for _, action := range actions {
+		switch action.actionType {
+		case copyCreate:
+			if action.isDir {
+				changes = append(changes, NewChange(ChangeCreate, "mkdir %s (%s)", action.targetPath, action.mode))
+			} else {
+				changes = append(changes, NewChange(ChangeCreate, "copy %s -> %s (%s)", action.sourcePath, action.targetPath, action.mode))
+			}
+		case copyUpdate:
+			changes = append(changes, NewChange(ChangeUpdate, "copy %s -> %s", action.sourcePath, action.targetPath))
+		case copyReplace:
+			changes = append(changes, NewChange(ChangeReplace, "replace %s with copy of %s", action.targetPath, action.sourcePath))
+		case copyChmod:
+			changes = append(changes, NewChange(ChangeUpdate, "chmod %s %s", action.mode, action.targetPath))
+		}
+	}
+
+	return changes, nil
+}
+
+// Execute copies the source file or directory tree into the target
+func (step CopyStep) Execute(exec StepExecutor) (Result, error) {
+	actions, err := step.inspect(exec)
+	if err != nil {
+		return Result{}, err
+	}
+	if len(actions) == 0 {
+		return NewResult(ResultUnchanged, "already up to date"), nil
+	}
+
+	targetRoot := exec.GetTargetPath(step.Target)
+	err = os.MkdirAll(filepath.Dir(targetRoot), os.FileMode(0o777))
+	if err != nil {
+		return Result{}, err
+	}
+
+	// Directory modes are applied last, in case they would prevent us from
+	// populating them
+	dirs := make([]copyAction, 0)
+	copied := 0
+
+	for _, action := range actions {
+		if action.actionType == copyReplace {
+			err = exec.ForceRemove(action.targetPath)
+			if err != nil {
+				return Result{}, err
+			}
+		}
+		if action.actionType != copyChmod && !action.isDir {
+			copied++
+		}
+
+		switch action.actionType {
+		case copyCreate, copyReplace, copyUpdate:
+			if action.isDir {
+				err = os.Mkdir(action.targetPath, action.mode)
+				if err == nil {
+					exec.Track(TrackedDirectory, action.targetPath, "")
+				}
+			} else {
+				err = copyFile(action.sourcePath, action.targetPath, action.mode)
+				if err == nil {
+					exec.Track(TrackedFile, action.targetPath, "")
+				}
+			}
+		}
+		if err != nil {
+			return Result{}, err
+		}
+
+		if action.isDir {
+			dirs = append(dirs, action)
+			continue
+		}
+		err = os.Chmod(action.targetPath, action.mode)
+		if err != nil {
+			return Result{}, err
+		}
+	}
+
+	for idx := len(dirs) - 1; idx >= 0; idx-- {
+		err = os.Chmod(dirs[idx].targetPath, dirs[idx].mode)
+		if err != nil {
+			return Result{}, err
+		}
+	}
+
+	status := ResultUpdated
+	if actions[0].targetPath == targetRoot && actions[0].actionType == copyCreate {
+		status = ResultCreated
+	} else if actions[0].targetPath == targetRoot && actions[0].actionType == copyReplace {
+		status = ResultReplaced
+	}
+	if copied == 0 {
+		return NewResult(status, "changed modes"), nil
+	}
+	return NewResult(status, "copied %d file(s)", copied), nil
+}
+
+// Uninstall removes the copied files and directories that were created by
+// dotter, leaving anything else that has since been put alongside them, and
+// then restores whatever the copy replaced
+func (step CopyStep) Uninstall(exec StepExecutor) error {
+	targetRoot := exec.GetTargetPath(step.Target)
+	if !exec.IsTracked(targetRoot) {
+		return nil
+	}
+
+	paths := make([]string, 0)
+	err := filepath.Walk(targetRoot, func(path string, fileInfo os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		paths = append(paths, path)
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	// Go deepest-first, so that directories are emptied before we get to them
+	for idx := len(paths) - 1; idx >= 0; idx-- {
+		if !exec.IsTracked(paths[idx]) {
+			continue
+		}
+		err = os.Remove(paths[idx])
+		if err != nil {
+			exec.PrintInfo(fmt.Sprintf("Leaving %s as it is not empty", paths[idx]))
+			continue
+		}
+		exec.Untrack(paths[idx])
+	}
+
+	if _, err = os.Lstat(targetRoot); !os.IsNotExist(err) {
+		return nil
+	}
+	exec.PrintInfo(fmt.Sprintf("Removed %s", targetRoot))
+
+	_, err = exec.RestoreBackup(targetRoot)
+	return err
+}
@@ -0,0 +1,231 @@
+package step_test
+
+import (
+	"io/ioutil"
+	"os"
+	"time"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	"github.com/jayclassless/dotter/step"
+)
+
+var _ = Describe("CopyStep", func() {
+	Describe("NewCopyStep", func() {
+		It("Works", func() {
+			Expect(step.NewCopyStep()).ShouldNot(BeNil())
+		})
+	})
+
+	Describe("GetActivityLabel", func() {
+		It("Works", func() {
+			Expect(step.NewCopyStep().GetActivityLabel()).To(Equal("Copying"))
+		})
+	})
+
+	Describe("GetActivityDetails", func() {
+		It("Works", func() {
+			step := step.NewCopyStep()
+			step.Target = "foobar"
+
+			Expect(step.GetActivityDetails()).To(Equal("foobar"))
+		})
+	})
+
+	Describe("Plan", func() {
+		var executor *TestExecutor
+
+		BeforeEach(func() {
+			executor = NewTestExecutor(tmpdir(), tmpdir())
+			mkdir(executor.source, "tree", "sub")
+			writeFile(executor.source, "tree/sub/file", "file")
+		})
+
+		AfterEach(func() {
+			rmdir(executor.target)
+			rmdir(executor.source)
+		})
+
+		It("Plans new trees", func() {
+			s := step.NewCopyStep()
+			s.Target = "tree"
+			s.Source = "tree"
+
+			changes, err := s.Plan(executor)
+			Expect(err).Should(Succeed())
+			Expect(changes).To(HaveLen(3))
+			for _, change := range changes {
+				Expect(change.Type).To(Equal(step.ChangeCreate))
+			}
+
+			_, err = os.Stat(executor.GetTargetPath("tree"))
+			Expect(os.IsNotExist(err)).To(BeTrue())
+		})
+
+		It("Plans nothing for identical trees", func() {
+			s := step.NewCopyStep()
+			s.Target = "tree"
+			s.Source = "tree"
+			Expect(s.Execute(executor)).To(haveStatus("created"))
+
+			changes, err := s.Plan(executor)
+			Expect(err).Should(Succeed())
+			Expect(changes).To(HaveLen(0))
+		})
+	})
+
+	Describe("Execute", func() {
+		var executor *TestExecutor
+
+		BeforeEach(func() {
+			executor = NewTestExecutor(tmpdir(), tmpdir())
+			writeFile(executor.source, "file", "file")
+			os.Chmod(executor.GetSourcePath("file"), 0o600)
+			mkdir(executor.source, "tree", "sub")
+			writeFile(executor.source, "tree/sub/file", "file")
+			os.Chmod(executor.GetSourcePath("tree/sub/file"), 0o755)
+		})
+
+		AfterEach(func() {
+			rmdir(executor.target)
+			rmdir(executor.source)
+		})
+
+		readTarget := func(path string) string {
+			content, err := ioutil.ReadFile(executor.GetTargetPath(path))
+			Expect(err).Should(Succeed())
+			return string(content)
+		}
+
+		modeOf := func(path string) os.FileMode {
+			fileInfo, err := os.Lstat(executor.GetTargetPath(path))
+			Expect(err).Should(Succeed())
+			return fileInfo.Mode().Perm()
+		}
+
+		It("Copies files", func() {
+			s := step.NewCopyStep()
+			s.Target = "some/deep/file"
+			s.Source = "file"
+
+			_, err := s.Execute(executor)
+			Expect(err).Should(Succeed())
+			Expect(readTarget("some/deep/file")).To(Equal("file"))
+			Expect(modeOf("some/deep/file")).To(Equal(os.FileMode(0o600)))
+			Expect(executor.tracked).To(HaveKeyWithValue(executor.GetTargetPath("some/deep/file"), step.TrackedFile))
+		})
+
+		It("Copies directory trees", func() {
+			s := step.NewCopyStep()
+			s.Target = "tree"
+			s.Source = "tree"
+
+			result, err := s.Execute(executor)
+			Expect(err).Should(Succeed())
+			Expect(result).To(haveStatus("created"))
+			Expect(readTarget("tree/sub/file")).To(Equal("file"))
+			Expect(modeOf("tree/sub/file")).To(Equal(os.FileMode(0o755)))
+			Expect(executor.tracked).To(HaveLen(3))
+		})
+
+		It("Skips files with matching checksums", func() {
+			s := step.NewCopyStep()
+			s.Target = "file"
+			s.Source = "file"
+			writeFile(executor.target, "file", "file")
+			os.Chmod(executor.GetTargetPath("file"), 0o600)
+			past := time.Now().Add(-time.Hour)
+			os.Chtimes(executor.GetTargetPath("file"), past, past)
+			before, _ := os.Stat(executor.GetTargetPath("file"))
+
+			result, err := s.Execute(executor)
+			Expect(err).Should(Succeed())
+			Expect(result).To(haveStatus("unchanged"))
+			after, _ := os.Stat(executor.GetTargetPath("file"))
+			Expect(after.ModTime()).To(Equal(before.ModTime()))
+			Expect(executor.backedUp).To(HaveLen(0))
+		})
+
+		It("Fixes modes on matching files", func() {
+			s := step.NewCopyStep()
+			s.Target = "file"
+			s.Source = "file"
+			writeFile(executor.target, "file", "file")
+			os.Chmod(executor.GetTargetPath("file"), 0o644)
+
+			result, err := s.Execute(executor)
+			Expect(err).Should(Succeed())
+			Expect(result).To(haveStatus("updated"))
+			Expect(modeOf("file")).To(Equal(os.FileMode(0o600)))
+		})
+
+		It("Updates files it copied before", func() {
+			s := step.NewCopyStep()
+			s.Target = "file"
+			s.Source = "file"
+			Expect(s.Execute(executor)).To(haveStatus("created"))
+
+			writeFile(executor.source, "file", "changed")
+			Expect(s.Execute(executor)).To(haveStatus("updated"))
+			Expect(readTarget("file")).To(Equal("changed"))
+			Expect(executor.backedUp).To(HaveLen(0))
+		})
+
+		It("Fails on deep paths when CreateParents is disabled", func() {
+			s := step.NewCopyStep()
+			s.Target = "some/deep/file"
+			s.Source = "file"
+			s.CreateParents = false
+
+			_, err := s.Execute(executor)
+			Expect(err).Should(HaveOccurred())
+		})
+
+		It("Fails on collisions when Force is disabled", func() {
+			s := step.NewCopyStep()
+			s.Target = "file"
+			s.Source = "file"
+			writeFile(executor.target, "file", "mine")
+
+			_, err := s.Execute(executor)
+			Expect(err).Should(HaveOccurred())
+			Expect(readTarget("file")).To(Equal("mine"))
+		})
+
+		It("Handles collisions when Force is enabled", func() {
+			s := step.NewCopyStep()
+			s.Target = "tree"
+			s.Source = "tree"
+			s.Force = true
+			writeFile(executor.target, "tree", "mine")
+
+			_, err := s.Execute(executor)
+			Expect(err).Should(Succeed())
+			Expect(executor.backedUp).To(Equal([]string{executor.GetTargetPath("tree")}))
+			Expect(readTarget("tree/sub/file")).To(Equal("file"))
+		})
+	})
+
+	Describe("Uninstall", func() {
+		It("Removes what it copied", func() {
+			executor := NewTestExecutor(tmpdir(), tmpdir())
+			defer rmdir(executor.target)
+			defer rmdir(executor.source)
+			mkdir(executor.source, "tree")
+			writeFile(executor.source, "tree/file", "file")
+
+			s := step.NewCopyStep()
+			s.Target = "tree"
+			s.Source = "tree"
+			Expect(s.Execute(executor)).To(haveStatus("created"))
+			writeFile(executor.target, "tree/mine", "mine")
+
+			Expect(s.Uninstall(executor)).Should(Succeed())
+			_, err := os.Stat(executor.GetTargetPath("tree/file"))
+			Expect(os.IsNotExist(err)).To(BeTrue())
+			_, err = os.Stat(executor.GetTargetPath("tree/mine"))
+			Expect(err).Should(Succeed())
+		})
+	})
+})
@@ -2,6 +2,7 @@ package step
 
 import (
 	"fmt"
+	"io/ioutil"
 	"os"
 	"path/filepath"
 )
@@ -25,6 +26,7 @@ func NewDirectoryOptions() DirectoryOptions {
 // DirectoryStep contains the specification for Directory steps
 type DirectoryStep struct {
 	DirectoryOptions `yaml:",inline"`
+	StepMeta         `yaml:",inline"`
 	Target           string `yaml:"path"`
 }
 
@@ -50,60 +52,162 @@ func (step DirectoryStep) GetActivityDetails() string {
 	return step.Target
 }
 
-// Execute creates the specified directory
-func (step DirectoryStep) Execute(exec StepExecutor) error {
-	targetPath := exec.GetTargetPath(step.Target)
+type directoryInspection struct {
+	targetPath    string
+	parentPath    string
+	exists        bool
+	blocked       bool
+	parentMissing bool
+	wrongMode     bool
+}
 
-	fileInfo, err := os.Stat(targetPath)
-	if err != nil {
-		if !os.IsNotExist(err) {
-			return err
+func (step DirectoryStep) inspect(exec StepExecutor) (directoryInspection, error) {
+	result := directoryInspection{}
+	result.targetPath = exec.GetTargetPath(step.Target)
+	result.parentPath = filepath.Dir(result.targetPath)
+
+	fileInfo, err := os.Stat(result.targetPath)
+	if err == nil {
+		result.exists = true
+		if fileInfo.IsDir() {
+			result.wrongMode = fileInfo.Mode().Perm() != os.FileMode(step.Mode).Perm()
+			return result, nil
 		}
-	} else {
-		if !fileInfo.IsDir() {
-			if step.Force {
-				err = exec.ForceRemove(targetPath)
-				if err != nil {
-					return err
-				}
-			} else {
-				return fmt.Errorf("Non-directory %s already exists", targetPath)
-			}
+		if !step.Force {
+			return result, fmt.Errorf("Non-directory %s already exists", result.targetPath)
 		}
+		result.blocked = true
+	} else if !os.IsNotExist(err) {
+		return result, err
 	}
 
-	desiredMode := os.FileMode(step.Mode)
+	_, err = os.Stat(result.parentPath)
+	if os.IsNotExist(err) {
+		if !step.CreateParents {
+			return result, fmt.Errorf(
+				"Cannot create %s as parent directory %s does not exist",
+				step.Target,
+				result.parentPath,
+			)
+		}
+		result.parentMissing = true
+	} else if err != nil {
+		return result, err
+	}
+
+	return result, nil
+}
 
-	fileInfo, err = os.Stat(targetPath)
+// Plan describes the changes that Execute would make to create the specified directory
+func (step DirectoryStep) Plan(exec StepExecutor) ([]Change, error) {
+	inspection, err := step.inspect(exec)
 	if err != nil {
-		if !os.IsNotExist(err) {
-			return err
+		return nil, err
+	}
+
+	changes := make([]Change, 0)
+	mode := os.FileMode(step.Mode).Perm()
+
+	if inspection.blocked {
+		changes = append(changes, NewChange(ChangeReplace, "replace %s with directory (%s)", inspection.targetPath, mode))
+	} else if !inspection.exists {
+		if inspection.parentMissing {
+			changes = append(changes, NewChange(ChangeCreate, "mkdir %s", inspection.parentPath))
 		}
+		changes = append(changes, NewChange(ChangeCreate, "mkdir %s (%s)", inspection.targetPath, mode))
+	} else if inspection.wrongMode {
+		changes = append(changes, NewChange(ChangeUpdate, "chmod %s %s", mode, inspection.targetPath))
+	}
+
+	return changes, nil
+}
+
+// Execute creates the specified directory
+func (step DirectoryStep) Execute(exec StepExecutor) (Result, error) {
+	inspection, err := step.inspect(exec)
+	if err != nil {
+		return Result{}, err
+	}
+
+	desiredMode := os.FileMode(step.Mode)
+	targetPath := inspection.targetPath
+	result := NewResult(ResultUnchanged, "already exists")
 
-		parentPath := filepath.Dir(targetPath)
-		_, err := os.Stat(parentPath)
-		if os.IsNotExist(err) {
-			if step.CreateParents {
-				os.MkdirAll(targetPath, desiredMode)
-			} else {
-				return fmt.Errorf(
-					"Cannot create %s as parent directory %s does not exist",
-					step.Target,
-					parentPath,
-				)
-			}
-		} else if err == nil {
-			os.Mkdir(targetPath, desiredMode)
+	if inspection.blocked {
+		err = exec.ForceRemove(targetPath)
+		if err != nil {
+			return Result{}, err
+		}
+		result = NewResult(ResultReplaced, "replaced with directory")
+	}
+
+	if !inspection.exists || inspection.blocked {
+		if inspection.parentMissing {
+			err = os.MkdirAll(targetPath, desiredMode)
 		} else {
-			return err
+			err = os.Mkdir(targetPath, desiredMode)
+		}
+		if err != nil {
+			return Result{}, err
+		}
+		exec.Track(TrackedDirectory, targetPath, "")
+		if !inspection.blocked {
+			result = NewResult(ResultCreated, "created")
 		}
+	}
 
-		fileInfo, err = os.Stat(targetPath)
+	fileInfo, err := os.Stat(targetPath)
+	if err != nil {
+		return Result{}, err
 	}
 
 	if fileInfo.Mode().Perm() != desiredMode.Perm() {
-		os.Chmod(targetPath, desiredMode)
+		err = os.Chmod(targetPath, desiredMode)
+		if err != nil {
+			return Result{}, err
+		}
+		if !result.Status.Changed() {
+			result = NewResult(ResultUpdated, "changed mode to %s", desiredMode.Perm())
+		}
+	}
+
+	return result, nil
+}
+
+// Uninstall removes the directory if it was created by a DirectoryStep and is
+// empty, and then restores whatever it replaced
+func (step DirectoryStep) Uninstall(exec StepExecutor) error {
+	targetPath := exec.GetTargetPath(step.Target)
+	if !exec.IsTracked(targetPath) {
+		return nil
+	}
+
+	fileInfo, err := os.Lstat(targetPath)
+	if os.IsNotExist(err) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+	if !fileInfo.IsDir() {
+		return nil
+	}
+
+	children, err := ioutil.ReadDir(targetPath)
+	if err != nil {
+		return err
+	}
+	if len(children) > 0 {
+		exec.PrintInfo(fmt.Sprintf("Leaving %s as it is not empty", targetPath))
+		return nil
+	}
+
+	err = os.Remove(targetPath)
+	if err != nil {
+		return err
 	}
+	exec.Untrack(targetPath)
+	exec.PrintInfo(fmt.Sprintf("Removed %s", targetPath))
 
-	return nil
+	_, err = exec.RestoreBackup(targetPath)
+	return err
 }
@@ -31,6 +31,68 @@ var _ = Describe("DirectoryStep", func() {
 		})
 	})
 
+	Describe("Plan", func() {
+		var executor *TestExecutor
+
+		BeforeEach(func() {
+			executor = NewTestExecutor(tmpdir(), tmpdir())
+		})
+
+		AfterEach(func() {
+			rmdir(executor.target)
+			rmdir(executor.source)
+		})
+
+		It("Plans new directories", func() {
+			step := step.NewDirectoryStep()
+			step.Target = "foo"
+
+			changes, err := step.Plan(executor)
+			Expect(err).Should(Succeed())
+			Expect(changes).To(HaveLen(1))
+			Expect(changes[0].Description).To(Equal("mkdir " + executor.GetTargetPath("foo") + " (-rwxr-xr-x)"))
+
+			_, err = os.Stat(executor.GetTargetPath("foo"))
+			Expect(os.IsNotExist(err)).To(BeTrue())
+		})
+
+		It("Plans mode changes", func() {
+			s := step.NewDirectoryStep()
+			s.Target = "foo"
+			s.Mode = 0o700
+			mkdir(executor.GetTargetPath("foo"))
+
+			changes, err := s.Plan(executor)
+			Expect(err).Should(Succeed())
+			Expect(changes).To(HaveLen(1))
+			Expect(changes[0].Type).To(Equal(step.ChangeUpdate))
+		})
+
+		It("Plans nothing for existing directories", func() {
+			step := step.NewDirectoryStep()
+			step.Target = "foo"
+			mkdir(executor.GetTargetPath("foo"))
+			os.Chmod(executor.GetTargetPath("foo"), 0o755)
+
+			changes, err := step.Plan(executor)
+			Expect(err).Should(Succeed())
+			Expect(changes).To(HaveLen(0))
+		})
+
+		It("Plans replacements when Force is enabled", func() {
+			s := step.NewDirectoryStep()
+			s.Target = "foo"
+			s.Force = true
+			writeFile(executor.target, "foo", "foo")
+
+			changes, err := s.Plan(executor)
+			Expect(err).Should(Succeed())
+			Expect(changes).To(HaveLen(1))
+			Expect(changes[0].Type).To(Equal(step.ChangeReplace))
+			Expect(executor.backedUp).To(HaveLen(0))
+		})
+	})
+
 	Describe("Execute", func() {
 		var executor *TestExecutor
 
@@ -47,8 +109,9 @@ var _ = Describe("DirectoryStep", func() {
 			step := step.NewDirectoryStep()
 			step.Target = "foo"
 
-			err := step.Execute(executor)
-			Expect(err).Should((Succeed()))
+			result, err := step.Execute(executor)
+			Expect(err).Should(Succeed())
+			Expect(result).To(haveStatus("created"))
 
 			fileInfo, err := os.Stat(executor.GetTargetPath("foo"))
 			Expect(err).Should(Succeed())
@@ -61,7 +124,7 @@ var _ = Describe("DirectoryStep", func() {
 			step.Target = "foo"
 			step.Mode = 0o611
 
-			err := step.Execute(executor)
+			_, err := step.Execute(executor)
 			Expect(err).Should((Succeed()))
 
 			fileInfo, err := os.Stat(executor.GetTargetPath("foo"))
@@ -79,8 +142,9 @@ var _ = Describe("DirectoryStep", func() {
 			fileInfo, err := os.Stat(executor.GetTargetPath("foo"))
 			Expect(fileInfo.Mode().Perm()).ToNot(Equal(os.FileMode(0o611)))
 
-			err = step.Execute(executor)
-			Expect(err).Should((Succeed()))
+			result, err := step.Execute(executor)
+			Expect(err).Should(Succeed())
+			Expect(result).To(haveStatus("updated"))
 
 			fileInfo, err = os.Stat(executor.GetTargetPath("foo"))
 			Expect(err).Should(Succeed())
@@ -92,7 +156,7 @@ var _ = Describe("DirectoryStep", func() {
 			step := step.NewDirectoryStep()
 			step.Target = "foo/bar/baz"
 
-			err := step.Execute(executor)
+			_, err := step.Execute(executor)
 			Expect(err).Should((Succeed()))
 
 			fileInfo, err := os.Stat(executor.GetTargetPath("foo/bar/baz"))
@@ -106,7 +170,7 @@ var _ = Describe("DirectoryStep", func() {
 			step.CreateParents = false
 			step.Target = "foo/bar/baz"
 
-			err := step.Execute(executor)
+			_, err := step.Execute(executor)
 			Expect(err).Should(HaveOccurred())
 
 			_, err = os.Stat(executor.GetTargetPath("foo/bar/baz"))
@@ -119,8 +183,9 @@ var _ = Describe("DirectoryStep", func() {
 			step.Force = true
 			writeFile(executor.target, "foo", "foo")
 
-			err := step.Execute(executor)
+			result, err := step.Execute(executor)
 			Expect(err).Should(Succeed())
+			Expect(result).To(haveStatus("replaced"))
 			Expect(executor.backedUp).To(HaveLen(1))
 
 			fileInfo, err := os.Stat(executor.GetTargetPath("foo"))
@@ -134,7 +199,7 @@ var _ = Describe("DirectoryStep", func() {
 			step.Target = "foo"
 			writeFile(executor.target, "foo", "foo")
 
-			err := step.Execute(executor)
+			_, err := step.Execute(executor)
 			Expect(err).Should(HaveOccurred())
 			Expect(executor.backedUp).To(HaveLen(0))
 
@@ -143,4 +208,57 @@ var _ = Describe("DirectoryStep", func() {
 			Expect(fileInfo.Mode().IsRegular()).To(BeTrue())
 		})
 	})
+
+	Describe("Uninstall", func() {
+		var executor *TestExecutor
+
+		BeforeEach(func() {
+			executor = NewTestExecutor(tmpdir(), tmpdir())
+		})
+
+		AfterEach(func() {
+			rmdir(executor.target)
+			rmdir(executor.source)
+		})
+
+		It("Removes empty directories", func() {
+			step := step.NewDirectoryStep()
+			step.Target = "foo"
+			Expect(step.Execute(executor)).To(haveStatus("created"))
+			Expect(executor.tracked).To(HaveKey(executor.GetTargetPath("foo")))
+
+			err := step.Uninstall(executor)
+			Expect(err).Should(Succeed())
+
+			_, err = os.Stat(executor.GetTargetPath("foo"))
+			Expect(os.IsNotExist(err)).To(BeTrue())
+			Expect(executor.restored).To(Equal([]string{executor.GetTargetPath("foo")}))
+		})
+
+		It("Leaves directories it did not create", func() {
+			step := step.NewDirectoryStep()
+			step.Target = "foo"
+			mkdir(executor.GetTargetPath("foo"))
+
+			err := step.Uninstall(executor)
+			Expect(err).Should(Succeed())
+
+			_, err = os.Stat(executor.GetTargetPath("foo"))
+			Expect(err).Should(Succeed())
+		})
+
+		It("Leaves non-empty directories", func() {
+			step := step.NewDirectoryStep()
+			step.Target = "foo"
+			Expect(step.Execute(executor)).To(haveStatus("created"))
+			writeFile(executor.GetTargetPath("foo"), "bar", "bar")
+
+			err := step.Uninstall(executor)
+			Expect(err).Should(Succeed())
+
+			_, err = os.Stat(executor.GetTargetPath("foo"))
+			Expect(err).Should(Succeed())
+			Expect(executor.restored).To(HaveLen(0))
+		})
+	})
 })
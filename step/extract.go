@@ -0,0 +1,675 @@
+package step
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"compress/gzip"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"github.com/ulikunitz/xz"
+)
+
+// extractStampPrefix starts the name of the file left in the target directory
+// to record the checksum of what was extracted there, followed by the paths it
+// extracted; the rest of the name identifies the archive, so that several can
+// be extracted to the same directory
+const extractStampPrefix = ".dotter-extracted-"
+
+// ExtractOptions contains non-path options for Extract steps
+type ExtractOptions struct {
+	CreateParents   bool `yaml:"create_parents"`
+	StripComponents int  `yaml:"strip_components"`
+	Include         StringList
+	Force           bool
+}
+
+// NewExtractOptions creates a new instance of an ExtractOptions struct
+func NewExtractOptions() ExtractOptions {
+	opt := ExtractOptions{}
+	opt.CreateParents = true
+	opt.StripComponents = 0
+	opt.Force = false
+	return opt
+}
+
+// ExtractStep contains the specification for Extract steps
+type ExtractStep struct {
+	ExtractOptions `yaml:",inline"`
+	StepMeta       `yaml:",inline"`
+	Target         string
+	Source         string
+}
+
+// NewExtractStep creates a new instance of an ExtractStep struct using default options
+func NewExtractStep() ExtractStep {
+	return NewExtractStepWithDefaults(NewExtractOptions())
+}
+
+// NewExtractStepWithDefaults creates a new instance of an ExtractStep struct using the specified options
+func NewExtractStepWithDefaults(defaults ExtractOptions) ExtractStep {
+	step := ExtractStep{}
+	step.ExtractOptions = defaults
+	return step
+}
+
+// GetActivityLabel returns a short description of what an ExtractStep does
+func (step ExtractStep) GetActivityLabel() string {
+	return "Extracting"
+}
+
+// GetActivityDetails returns description specific to this particular instance of the ExtractStep
+func (step ExtractStep) GetActivityDetails() string {
+	return step.Target
+}
+
+type extractInspection struct {
+	sourcePath    string
+	targetPath    string
+	parentPath    string
+	checksum      string
+	exists        bool
+	blocked       bool
+	parentMissing bool
+	current       bool
+	extracted     []string
+	collisions    []string
+}
+
+// getStampPath returns where the stamp file for the archive goes
+func (step ExtractStep) getStampPath(targetPath string) string {
+	hash := sha256.Sum256([]byte(step.Source))
+	return filepath.Join(targetPath, extractStampPrefix+hex.EncodeToString(hash[:])[:12])
+}
+
+// getChecksum identifies the archive and the options that decide what is
+// extracted from it, so that changing either causes it to be extracted again
+func (step ExtractStep) getChecksum(sourcePath string) (string, error) {
+	sum, err := Checksum(sourcePath)
+	if err != nil {
+		return "", err
+	}
+
+	hash := sha256.New()
+	fmt.Fprintf(hash, "%s\x00%d", sum, step.StripComponents)
+	for _, pattern := range step.Include {
+		fmt.Fprintf(hash, "\x00%s", pattern)
+	}
+
+	return hex.EncodeToString(hash.Sum(nil)), nil
+}
+
+func (step ExtractStep) inspect(exec StepExecutor) (extractInspection, error) {
+	result := extractInspection{}
+	result.sourcePath = exec.GetSourcePath(step.Source)
+	result.targetPath = exec.GetTargetPath(step.Target)
+	result.parentPath = filepath.Dir(result.targetPath)
+
+	_, err := archiveFormat(result.sourcePath)
+	if err != nil {
+		return result, err
+	}
+	result.checksum, err = step.getChecksum(result.sourcePath)
+	if err != nil {
+		return result, err
+	}
+
+	fileInfo, err := os.Lstat(result.targetPath)
+	if err == nil {
+		result.exists = true
+		if !fileInfo.IsDir() {
+			if !step.Force {
+				return result, fmt.Errorf("%s already exists", result.targetPath)
+			}
+			result.blocked = true
+			return result, nil
+		}
+
+		stamp, err := ioutil.ReadFile(step.getStampPath(result.targetPath))
+		if err == nil {
+			lines := strings.Split(strings.TrimSpace(string(stamp)), "\n")
+			result.current = lines[0] == result.checksum
+			result.extracted = lines[1:]
+		} else if !os.IsNotExist(err) {
+			return result, err
+		}
+		if result.current {
+			return result, nil
+		}
+
+		result.collisions, err = step.findCollisions(result.sourcePath, result.targetPath, result.extracted)
+		if err != nil {
+			return result, err
+		}
+		if len(result.collisions) > 0 && !step.Force {
+			return result, fmt.Errorf("%s already exists", result.collisions[0])
+		}
+		return result, nil
+
+	} else if !os.IsNotExist(err) {
+		return result, err
+	}
+
+	_, err = os.Stat(result.parentPath)
+	if os.IsNotExist(err) {
+		if !step.CreateParents {
+			return result, fmt.Errorf(
+				"Cannot create %s as parent directory %s does not exist",
+				step.Target,
+				result.parentPath,
+			)
+		}
+		result.parentMissing = true
+	} else if err != nil {
+		return result, err
+	}
+
+	return result, nil
+}
+
+// Plan describes the changes that Execute would make to extract the archive
+func (step ExtractStep) Plan(exec StepExecutor) ([]Change, error) {
+	inspection, err := step.inspect(exec)
+	if err != nil {
+		return nil, err
+	}
+
+	changes := make([]Change, 0)
+
+	if inspection.blocked {
+		changes = append(changes, NewChange(ChangeReplace, "replace %s with contents of %s", inspection.targetPath, inspection.sourcePath))
+	} else if !inspection.exists {
+		if inspection.parentMissing {
+			changes = append(changes, NewChange(ChangeCreate, "mkdir %s", inspection.parentPath))
+		}
+		changes = append(changes, NewChange(ChangeCreate, "extract %s -> %s", inspection.sourcePath, inspection.targetPath))
+	} else if !inspection.current {
+		for _, collision := range inspection.collisions {
+			changes = append(changes, NewChange(ChangeReplace, "replace %s", collision))
+		}
+		changes = append(changes, NewChange(ChangeUpdate, "extract %s -> %s", inspection.sourcePath, inspection.targetPath))
+	}
+
+	return changes, nil
+}
+
+// Execute extracts the archive into the target directory, unless the stamp
+// file shows that the same archive has already been extracted there
+func (step ExtractStep) Execute(exec StepExecutor) (Result, error) {
+	inspection, err := step.inspect(exec)
+	if err != nil {
+		return Result{}, err
+	}
+
+	if inspection.exists && !inspection.blocked && inspection.current {
+		return NewResult(ResultUnchanged, "already extracted"), nil
+	}
+
+	if inspection.blocked {
+		err = exec.ForceRemove(inspection.targetPath)
+		if err != nil {
+			return Result{}, err
+		}
+	}
+	if !inspection.exists || inspection.blocked {
+		err = os.MkdirAll(inspection.targetPath, os.FileMode(0o777))
+		if err != nil {
+			return Result{}, err
+		}
+	} else {
+		// Whatever the earlier archive had that this one doesn't would
+		// otherwise be left behind
+		err = removeExtracted(inspection.targetPath, inspection.extracted)
+		if err != nil {
+			return Result{}, err
+		}
+		for _, collision := range inspection.collisions {
+			err = exec.ForceRemove(collision)
+			if err != nil {
+				return Result{}, err
+			}
+		}
+	}
+
+	extracted, paths, err := step.extract(inspection.sourcePath, inspection.targetPath)
+	if err != nil {
+		return Result{}, err
+	}
+
+	stamp := append([]string{inspection.checksum}, paths...)
+	err = ioutil.WriteFile(
+		step.getStampPath(inspection.targetPath),
+		[]byte(strings.Join(stamp, "\n")+"\n"),
+		os.FileMode(0o644),
+	)
+	if err != nil {
+		return Result{}, err
+	}
+
+	status := ResultUpdated
+	if inspection.blocked {
+		status = ResultReplaced
+	} else if !inspection.exists {
+		status = ResultCreated
+	}
+	return NewResult(status, "extracted %d file(s)", extracted), nil
+}
+
+type archiveEntry struct {
+	name     string
+	mode     os.FileMode
+	linkname string
+	open     func() (io.ReadCloser, error)
+}
+
+func archiveFormat(sourcePath string) (string, error) {
+	name := strings.ToLower(sourcePath)
+	switch {
+	case strings.HasSuffix(name, ".tar.gz"), strings.HasSuffix(name, ".tgz"):
+		return "tar.gz", nil
+	case strings.HasSuffix(name, ".tar.xz"), strings.HasSuffix(name, ".txz"):
+		return "tar.xz", nil
+	case strings.HasSuffix(name, ".tar"):
+		return "tar", nil
+	case strings.HasSuffix(name, ".zip"):
+		return "zip", nil
+	}
+	return "", fmt.Errorf("Unsupported archive format for %s", sourcePath)
+}
+
+// walkArchive calls the specified function for every entry in the archive
+func walkArchive(sourcePath string, fn func(archiveEntry) error) error {
+	format, err := archiveFormat(sourcePath)
+	if err != nil {
+		return err
+	}
+	if format == "zip" {
+		return walkZip(sourcePath, fn)
+	}
+
+	file, err := os.Open(sourcePath)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	var reader io.Reader = file
+	if format == "tar.gz" {
+		gzipReader, err := gzip.NewReader(file)
+		if err != nil {
+			return err
+		}
+		defer gzipReader.Close()
+		reader = gzipReader
+	} else if format == "tar.xz" {
+		reader, err = xz.NewReader(file)
+		if err != nil {
+			return err
+		}
+	}
+
+	return walkTar(tar.NewReader(reader), fn)
+}
+
+func walkTar(reader *tar.Reader, fn func(archiveEntry) error) error {
+	for {
+		header, err := reader.Next()
+		if err == io.EOF {
+			return nil
+		} else if err != nil {
+			return err
+		}
+
+		entry := archiveEntry{
+			name:     header.Name,
+			mode:     header.FileInfo().Mode(),
+			linkname: header.Linkname,
+			open: func() (io.ReadCloser, error) {
+				return ioutil.NopCloser(reader), nil
+			},
+		}
+		if header.Typeflag == tar.TypeLink {
+			// Hard links become copies of the file they point to, which has
+			// already been extracted by the time we get here
+			entry.mode = os.FileMode(header.Mode).Perm()
+			entry.open = nil
+		}
+
+		err = fn(entry)
+		if err != nil {
+			return err
+		}
+	}
+}
+
+func walkZip(sourcePath string, fn func(archiveEntry) error) error {
+	reader, err := zip.OpenReader(sourcePath)
+	if err != nil {
+		return err
+	}
+	defer reader.Close()
+
+	for _, file := range reader.File {
+		file := file
+		entry := archiveEntry{
+			name: file.Name,
+			mode: file.Mode(),
+			open: file.Open,
+		}
+
+		if IsSymLink(file.FileInfo()) {
+			// Zip archives store the target of a symlink as its content
+			content, err := file.Open()
+			if err != nil {
+				return err
+			}
+			link, err := ioutil.ReadAll(content)
+			content.Close()
+			if err != nil {
+				return err
+			}
+			entry.linkname = string(link)
+		}
+
+		err = fn(entry)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// getEntryPath returns where in the target directory an entry in the archive
+// belongs, or "" if it is stripped or not included
+func (step ExtractStep) getEntryPath(name string) string {
+	// Cleaning from the root keeps entries like ../foo from escaping the target
+	cleaned := strings.TrimPrefix(path.Clean("/"+name), "/")
+	if cleaned == "" {
+		return ""
+	}
+
+	parts := strings.Split(cleaned, "/")
+	if len(parts) <= step.StripComponents {
+		return ""
+	}
+	entryPath := strings.Join(parts[step.StripComponents:], "/")
+
+	if len(step.Include) == 0 {
+		return entryPath
+	}
+	for _, pattern := range step.Include {
+		// Matching a directory includes everything inside of it
+		for candidate := entryPath; candidate != "."; candidate = path.Dir(candidate) {
+			if matched, _ := path.Match(pattern, candidate); matched {
+				return entryPath
+			}
+		}
+	}
+
+	return ""
+}
+
+// extractGuard keeps what is extracted from an archive within the target
+// directory, even when the archive contains symlinks that earlier entries
+// have already created
+type extractGuard struct {
+	targetPath string
+	links      map[string]bool
+	traversed  map[string]bool
+	written    []string
+}
+
+func newExtractGuard(targetPath string) (*extractGuard, error) {
+	resolved, err := filepath.EvalSymlinks(targetPath)
+	if err != nil {
+		return nil, err
+	}
+	return &extractGuard{
+		targetPath: resolved,
+		links:      make(map[string]bool),
+		traversed:  make(map[string]bool),
+	}, nil
+}
+
+// prepareDirectory creates the directory an entry is written to, making sure
+// that it doesn't end up outside of the target by way of a symlink, and
+// returns where it really is
+func (guard *extractGuard) prepareDirectory(name string, dir string, mode os.FileMode) (string, error) {
+	// Only what already exists can be a symlink; anything missing is created
+	// as a real directory
+	existing := dir
+	for {
+		resolved, err := filepath.EvalSymlinks(existing)
+		if err == nil {
+			if !IsWithin(resolved, guard.targetPath) {
+				return "", fmt.Errorf("Archive entry %s would be written outside of %s", name, guard.targetPath)
+			}
+			break
+		} else if !os.IsNotExist(err) {
+			return "", err
+		}
+		existing = filepath.Dir(existing)
+	}
+
+	err := os.MkdirAll(dir, mode)
+	if err != nil {
+		return "", err
+	}
+	return filepath.EvalSymlinks(dir)
+}
+
+// record remembers that an entry was written to the specified path
+func (guard *extractGuard) record(fullPath string) {
+	relPath, _ := filepath.Rel(guard.targetPath, fullPath)
+	guard.written = append(guard.written, filepath.ToSlash(relPath))
+}
+
+// checkLink makes sure that a symlink about to be created in the directory
+// points within the target, without going through any other symlink from the
+// archive, which could be pointed elsewhere later
+func (guard *extractGuard) checkLink(name string, dir string, destination string, linkname string) error {
+	relPath, _ := filepath.Rel(guard.targetPath, destination)
+	relPath = filepath.ToSlash(relPath)
+	if guard.traversed[relPath] {
+		return fmt.Errorf("Archive entry %s replaces a directory that another symlink points through", name)
+	}
+
+	current, _ := filepath.Rel(guard.targetPath, dir)
+	current = filepath.ToSlash(current)
+	linked := filepath.ToSlash(linkname)
+	if filepath.IsAbs(linkname) {
+		if filepath.Clean(linkname) != linkname || !IsWithin(linkname, guard.targetPath) {
+			return fmt.Errorf("Archive entry %s links outside of %s", name, guard.targetPath)
+		}
+		current = "."
+		linked, _ = filepath.Rel(guard.targetPath, linkname)
+		linked = filepath.ToSlash(linked)
+	}
+
+	// Following the link a step at a time, as cleaning it would hide a ".."
+	// that comes after another symlink
+	for _, part := range strings.Split(linked, "/") {
+		if guard.links[current] {
+			return fmt.Errorf("Archive entry %s links through symlink %s", name, current)
+		}
+		guard.traversed[current] = true
+
+		switch part {
+		case "", ".":
+		case "..":
+			if current == "." {
+				return fmt.Errorf("Archive entry %s links outside of %s", name, guard.targetPath)
+			}
+			current = path.Dir(current)
+		default:
+			current = path.Join(current, part)
+		}
+	}
+	guard.links[relPath] = true
+
+	return nil
+}
+
+// findCollisions returns the files already in the target directory that the
+// archive would overwrite, other than those from its earlier extraction
+func (step ExtractStep) findCollisions(sourcePath string, targetPath string, extracted []string) ([]string, error) {
+	previous := make(map[string]bool)
+	for _, entryPath := range extracted {
+		previous[entryPath] = true
+	}
+
+	collisions := make([]string, 0)
+	err := walkArchive(sourcePath, func(entry archiveEntry) error {
+		entryPath := step.getEntryPath(entry.name)
+		if entryPath == "" || previous[entryPath] {
+			return nil
+		}
+		previous[entryPath] = true
+		destination := filepath.Join(targetPath, filepath.FromSlash(entryPath))
+
+		fileInfo, err := os.Lstat(destination)
+		if err != nil {
+			// Missing, or under something that is already in the way
+			return nil
+		}
+		// Directories are shared, so only something else in the way of one is
+		if !entry.mode.IsDir() || !fileInfo.IsDir() {
+			collisions = append(collisions, destination)
+		}
+		return nil
+	})
+
+	return collisions, err
+}
+
+// removeExtracted removes the paths recorded by an earlier extraction, along
+// with any directories that are left empty
+func removeExtracted(targetPath string, paths []string) error {
+	targetPath = filepath.Clean(targetPath)
+
+	for _, entryPath := range paths {
+		fullPath := filepath.Join(targetPath, filepath.FromSlash(path.Clean("/"+entryPath)))
+		fileInfo, err := os.Lstat(fullPath)
+		if os.IsNotExist(err) {
+			continue
+		} else if err != nil {
+			return err
+		}
+		if !fileInfo.IsDir() {
+			err = os.Remove(fullPath)
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	for _, entryPath := range paths {
+		fullPath := filepath.Join(targetPath, filepath.FromSlash(path.Clean("/"+entryPath)))
+		for dir := fullPath; dir != targetPath; dir = filepath.Dir(dir) {
+			err := os.Remove(dir)
+			if err != nil && !os.IsNotExist(err) {
+				// Still holds something that wasn't extracted
+				break
+			}
+		}
+	}
+
+	return nil
+}
+
+// extract writes the contents of the archive to the target directory,
+// returning how many files it extracted and the paths it wrote
+func (step ExtractStep) extract(sourcePath string, targetPath string) (int, []string, error) {
+	extracted := 0
+	guard, err := newExtractGuard(targetPath)
+	if err != nil {
+		return 0, nil, err
+	}
+
+	err = walkArchive(sourcePath, func(entry archiveEntry) error {
+		entryPath := step.getEntryPath(entry.name)
+		if entryPath == "" {
+			return nil
+		}
+		destination := filepath.Join(targetPath, filepath.FromSlash(entryPath))
+
+		if entry.mode.IsDir() {
+			dir, err := guard.prepareDirectory(entry.name, destination, entry.mode.Perm()|0o700)
+			if err != nil {
+				return err
+			}
+			guard.record(dir)
+			return nil
+		}
+
+		dir, err := guard.prepareDirectory(entry.name, filepath.Dir(destination), os.FileMode(0o777))
+		if err != nil {
+			return err
+		}
+		destination = filepath.Join(dir, filepath.Base(destination))
+		err = os.Remove(destination)
+		if err != nil && !os.IsNotExist(err) {
+			return err
+		}
+
+		if entry.mode&os.ModeSymlink != 0 {
+			err = guard.checkLink(entry.name, dir, destination, entry.linkname)
+			if err != nil {
+				return err
+			}
+			err = os.Symlink(entry.linkname, destination)
+			if err != nil {
+				return err
+			}
+			guard.record(destination)
+			extracted++
+			return nil
+
+		} else if entry.open == nil {
+			linkPath := step.getEntryPath(entry.linkname)
+			if linkPath == "" {
+				return fmt.Errorf("Archive entry %s links to %s, which was not extracted", entry.name, entry.linkname)
+			}
+			err = copyFile(filepath.Join(targetPath, filepath.FromSlash(linkPath)), destination, entry.mode.Perm())
+			if err != nil {
+				return err
+			}
+			guard.record(destination)
+			extracted++
+			return nil
+
+		} else if !entry.mode.IsRegular() {
+			// Devices, pipes and the like don't belong in a dotfiles tree
+			return nil
+		}
+
+		content, err := entry.open()
+		if err != nil {
+			return err
+		}
+		defer content.Close()
+
+		out, err := os.OpenFile(destination, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, entry.mode.Perm())
+		if err != nil {
+			return err
+		}
+		guard.record(destination)
+		_, err = io.Copy(out, content)
+		if err != nil {
+			out.Close()
+			return err
+		}
+		extracted++
+		return out.Close()
+	})
+
+	return extracted, guard.written, err
+}
@@ -0,0 +1,354 @@
+package step_test
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"compress/gzip"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"github.com/ulikunitz/xz"
+
+	"github.com/jayclassless/dotter/step"
+)
+
+var archiveFiles = []struct {
+	name    string
+	content string
+}{
+	{"tool-1.0/", ""},
+	{"tool-1.0/bin/tool", "#!/bin/sh\n"},
+	{"tool-1.0/README", "readme"},
+	{"tool-1.0/doc/tool.1", "manual"},
+}
+
+func writeTar(path string) {
+	file, err := os.Create(path)
+	Expect(err).Should(Succeed())
+	defer file.Close()
+
+	var out io.WriteCloser
+	if strings.HasSuffix(path, ".xz") {
+		out, err = xz.NewWriter(file)
+		Expect(err).Should(Succeed())
+	} else {
+		out = gzip.NewWriter(file)
+	}
+	defer out.Close()
+
+	archive := tar.NewWriter(out)
+	defer archive.Close()
+	for _, entry := range archiveFiles {
+		header := &tar.Header{Name: entry.name, Mode: 0o644, Size: int64(len(entry.content))}
+		if strings.HasSuffix(entry.name, "/") {
+			header.Typeflag, header.Mode = tar.TypeDir, 0o755
+		} else if strings.Contains(entry.name, "/bin/") {
+			header.Mode = 0o755
+		}
+		Expect(archive.WriteHeader(header)).Should(Succeed())
+		_, err = archive.Write([]byte(entry.content))
+		Expect(err).Should(Succeed())
+	}
+}
+
+func writeLinks(path string, headers ...*tar.Header) {
+	file, err := os.Create(path)
+	Expect(err).Should(Succeed())
+	defer file.Close()
+
+	archive := tar.NewWriter(file)
+	defer archive.Close()
+	for _, header := range headers {
+		if header.Typeflag == tar.TypeReg {
+			header.Mode, header.Size = 0o644, int64(len(header.Name))
+		}
+		Expect(archive.WriteHeader(header)).Should(Succeed())
+		if header.Typeflag == tar.TypeReg {
+			_, err = archive.Write([]byte(header.Name))
+			Expect(err).Should(Succeed())
+		}
+	}
+}
+
+func writeZip(path string) {
+	file, err := os.Create(path)
+	Expect(err).Should(Succeed())
+	defer file.Close()
+
+	archive := zip.NewWriter(file)
+	defer archive.Close()
+	for _, entry := range archiveFiles {
+		out, err := archive.Create(entry.name)
+		Expect(err).Should(Succeed())
+		_, err = out.Write([]byte(entry.content))
+		Expect(err).Should(Succeed())
+	}
+}
+
+var _ = Describe("ExtractStep", func() {
+	Describe("NewExtractStep", func() {
+		It("Works", func() {
+			Expect(step.NewExtractStep()).ShouldNot(BeNil())
+		})
+	})
+
+	Describe("GetActivityLabel", func() {
+		It("Works", func() {
+			Expect(step.NewExtractStep().GetActivityLabel()).To(Equal("Extracting"))
+		})
+	})
+
+	Describe("GetActivityDetails", func() {
+		It("Works", func() {
+			step := step.NewExtractStep()
+			step.Target = "foobar"
+
+			Expect(step.GetActivityDetails()).To(Equal("foobar"))
+		})
+	})
+
+	Describe("Execute", func() {
+		var executor *TestExecutor
+
+		BeforeEach(func() {
+			executor = NewTestExecutor(tmpdir(), tmpdir())
+			writeTar(filepath.Join(executor.source, "tool.tar.gz"))
+			writeTar(filepath.Join(executor.source, "tool.tar.xz"))
+			writeZip(filepath.Join(executor.source, "tool.zip"))
+		})
+
+		AfterEach(func() {
+			rmdir(executor.target)
+			rmdir(executor.source)
+		})
+
+		readTarget := func(path string) string {
+			content, err := ioutil.ReadFile(executor.GetTargetPath(path))
+			Expect(err).Should(Succeed())
+			return string(content)
+		}
+
+		for _, archive := range []string{"tool.tar.gz", "tool.tar.xz", "tool.zip"} {
+			archive := archive
+
+			It("Extracts "+archive, func() {
+				s := step.NewExtractStep()
+				s.Target = "opt/tool"
+				s.Source = archive
+
+				changes, err := s.Plan(executor)
+				Expect(err).Should(Succeed())
+				Expect(changes).To(HaveLen(2))
+
+				Expect(s.Execute(executor)).To(haveStatus("created"))
+				Expect(readTarget("opt/tool/tool-1.0/bin/tool")).To(Equal("#!/bin/sh\n"))
+				Expect(readTarget("opt/tool/tool-1.0/doc/tool.1")).To(Equal("manual"))
+			})
+		}
+
+		It("Keeps file modes", func() {
+			s := step.NewExtractStep()
+			s.Target = "tool"
+			s.Source = "tool.tar.gz"
+			Expect(s.Execute(executor)).To(haveStatus("created"))
+
+			fileInfo, err := os.Stat(executor.GetTargetPath("tool/tool-1.0/bin/tool"))
+			Expect(err).Should(Succeed())
+			Expect(fileInfo.Mode().Perm()).To(Equal(os.FileMode(0o755)))
+		})
+
+		It("Strips leading components and filters what is included", func() {
+			s := step.NewExtractStep()
+			s.Target = ".local"
+			s.Source = "tool.tar.xz"
+			s.StripComponents = 1
+			s.Include = []string{"bin", "README"}
+
+			result, err := s.Execute(executor)
+			Expect(err).Should(Succeed())
+			Expect(result.Message).To(Equal("extracted 2 file(s)"))
+			Expect(readTarget(".local/bin/tool")).To(Equal("#!/bin/sh\n"))
+			Expect(readTarget(".local/README")).To(Equal("readme"))
+			Expect(executor.GetTargetPath(".local/doc")).ToNot(BeADirectory())
+		})
+
+		It("Does not extract again until the archive or options change", func() {
+			s := step.NewExtractStep()
+			s.Target = "tool"
+			s.Source = "tool.zip"
+			Expect(s.Execute(executor)).To(haveStatus("created"))
+			writeFile(executor.target, "tool/tool-1.0/README", "mine")
+
+			changes, err := s.Plan(executor)
+			Expect(err).Should(Succeed())
+			Expect(changes).To(HaveLen(0))
+			Expect(s.Execute(executor)).To(haveStatus("unchanged"))
+			Expect(readTarget("tool/tool-1.0/README")).To(Equal("mine"))
+
+			s.StripComponents = 1
+			changes, err = s.Plan(executor)
+			Expect(err).Should(Succeed())
+			Expect(changes).To(HaveLen(1))
+			Expect(changes[0].Type).To(Equal(step.ChangeUpdate))
+			Expect(s.Execute(executor)).To(haveStatus("updated"))
+			Expect(readTarget("tool/README")).To(Equal("readme"))
+
+			archiveFiles[2].content = "new readme"
+			defer func() { archiveFiles[2].content = "readme" }()
+			writeZip(filepath.Join(executor.source, "tool.zip"))
+			Expect(s.Execute(executor)).To(haveStatus("updated"))
+			Expect(readTarget("tool/README")).To(Equal("new readme"))
+		})
+
+		It("Removes what the earlier archive had when extracting again", func() {
+			s := step.NewExtractStep()
+			s.Target = "tool"
+			s.Source = "tool.tar.gz"
+			mkdir(executor.target, "tool")
+			writeFile(executor.target, "tool/mine", "mine")
+			Expect(s.Execute(executor)).To(haveStatus("updated"))
+
+			s.Include = []string{"tool-1.0/README"}
+			Expect(s.Execute(executor)).To(haveStatus("updated"))
+			Expect(readTarget("tool/tool-1.0/README")).To(Equal("readme"))
+			Expect(executor.GetTargetPath("tool/tool-1.0/bin")).ToNot(BeADirectory())
+			Expect(executor.GetTargetPath("tool/tool-1.0/doc")).ToNot(BeADirectory())
+			Expect(readTarget("tool/mine")).To(Equal("mine"))
+		})
+
+		It("Extracts several archives to the same directory", func() {
+			writeLinks(filepath.Join(executor.source, "a.tar"), &tar.Header{Name: "bin/toola", Typeflag: tar.TypeReg})
+			writeLinks(filepath.Join(executor.source, "b.tar"), &tar.Header{Name: "bin/toolb", Typeflag: tar.TypeReg})
+			first := step.NewExtractStep()
+			first.Target = ".local"
+			first.Source = "a.tar"
+			second := step.NewExtractStep()
+			second.Target = ".local"
+			second.Source = "b.tar"
+
+			Expect(first.Execute(executor)).To(haveStatus("created"))
+			Expect(second.Execute(executor)).To(haveStatus("updated"))
+			Expect(first.Execute(executor)).To(haveStatus("unchanged"))
+			Expect(second.Execute(executor)).To(haveStatus("unchanged"))
+			Expect(readTarget(".local/bin/toola")).To(Equal("bin/toola"))
+			Expect(readTarget(".local/bin/toolb")).To(Equal("bin/toolb"))
+		})
+
+		It("Fails on files in the way when Force is disabled", func() {
+			mkdir(executor.target, "tool")
+			writeFile(executor.target, "tool/tool-1.0", "mine")
+			s := step.NewExtractStep()
+			s.Target = "tool"
+			s.Source = "tool.tar.gz"
+
+			_, err := s.Execute(executor)
+			Expect(err).To(MatchError(executor.GetTargetPath("tool/tool-1.0") + " already exists"))
+			Expect(readTarget("tool/tool-1.0")).To(Equal("mine"))
+		})
+
+		It("Replaces files in the way when Force is enabled", func() {
+			mkdir(executor.target, "tool")
+			mkdir(executor.target, "tool/tool-1.0")
+			writeFile(executor.target, "tool/tool-1.0/README", "mine")
+			s := step.NewExtractStep()
+			s.Target = "tool"
+			s.Source = "tool.tar.gz"
+			s.Force = true
+
+			changes, err := s.Plan(executor)
+			Expect(err).Should(Succeed())
+			Expect(changes).To(HaveLen(2))
+			Expect(changes[0].Type).To(Equal(step.ChangeReplace))
+
+			Expect(s.Execute(executor)).To(haveStatus("updated"))
+			Expect(executor.backedUp).To(Equal([]string{executor.GetTargetPath("tool/tool-1.0/README")}))
+			Expect(readTarget("tool/tool-1.0/README")).To(Equal("readme"))
+			Expect(s.Execute(executor)).To(haveStatus("unchanged"))
+		})
+
+		It("Extracts symlinks that stay within the target", func() {
+			writeLinks(
+				filepath.Join(executor.source, "links.tar"),
+				&tar.Header{Name: "bin/tool", Typeflag: tar.TypeReg},
+				&tar.Header{Name: "current", Typeflag: tar.TypeSymlink, Linkname: "bin"},
+				&tar.Header{Name: "share/tool", Typeflag: tar.TypeSymlink, Linkname: "../bin/tool"},
+			)
+			s := step.NewExtractStep()
+			s.Target = "tool"
+			s.Source = "links.tar"
+
+			Expect(s.Execute(executor)).To(haveStatus("created"))
+			Expect(readTarget("tool/current/tool")).To(Equal("bin/tool"))
+			Expect(readTarget("tool/share/tool")).To(Equal("bin/tool"))
+		})
+
+		It("Refuses to write outside of the target through symlinks", func() {
+			writeLinks(
+				filepath.Join(executor.source, "escape.tar"),
+				&tar.Header{Name: "d", Typeflag: tar.TypeSymlink, Linkname: "."},
+				&tar.Header{Name: "d/e/link", Typeflag: tar.TypeSymlink, Linkname: "../.."},
+				&tar.Header{Name: "d/e/link/evil", Typeflag: tar.TypeReg},
+			)
+			s := step.NewExtractStep()
+			s.Target = "tool"
+			s.Source = "escape.tar"
+
+			_, err := s.Execute(executor)
+			Expect(err).To(MatchError(ContainSubstring("links outside of")))
+			Expect(executor.GetTargetPath("evil")).ToNot(BeAnExistingFile())
+			Expect(executor.GetTargetPath("tool/evil")).ToNot(BeAnExistingFile())
+		})
+
+		It("Refuses symlinks that point through other symlinks", func() {
+			writeLinks(
+				filepath.Join(executor.source, "chain.tar"),
+				&tar.Header{Name: "d", Typeflag: tar.TypeSymlink, Linkname: "."},
+				&tar.Header{Name: "up", Typeflag: tar.TypeSymlink, Linkname: "d/.."},
+			)
+			s := step.NewExtractStep()
+			s.Target = "tool"
+			s.Source = "chain.tar"
+
+			_, err := s.Execute(executor)
+			Expect(err).To(MatchError(ContainSubstring("links through symlink d")))
+		})
+
+		It("Fails on unsupported formats", func() {
+			writeFile(executor.source, "tool.rar", "")
+			s := step.NewExtractStep()
+			s.Target = "tool"
+			s.Source = "tool.rar"
+
+			_, err := s.Execute(executor)
+			Expect(err).To(MatchError(ContainSubstring("Unsupported archive format")))
+		})
+
+		It("Fails on collisions when Force is disabled", func() {
+			writeFile(executor.target, "tool", "mine")
+			s := step.NewExtractStep()
+			s.Target = "tool"
+			s.Source = "tool.tar.gz"
+
+			_, err := s.Execute(executor)
+			Expect(err).Should(HaveOccurred())
+			Expect(readTarget("tool")).To(Equal("mine"))
+		})
+
+		It("Handles collisions when Force is enabled", func() {
+			writeFile(executor.target, "tool", "mine")
+			s := step.NewExtractStep()
+			s.Target = "tool"
+			s.Source = "tool.tar.gz"
+			s.Force = true
+
+			Expect(s.Execute(executor)).To(haveStatus("replaced"))
+			Expect(executor.backedUp).To(HaveLen(1))
+			Expect(readTarget("tool/tool-1.0/README")).To(Equal("readme"))
+		})
+	})
+})
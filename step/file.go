@@ -0,0 +1,397 @@
+package step
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+type fileInspection struct {
+	targetPath    string
+	parentPath    string
+	exists        bool
+	blocked       bool
+	parentMissing bool
+	changed       bool
+	wrongMode     bool
+}
+
+// inspectFile compares the desired content of a file that dotter manages with
+// what is currently in the target
+func inspectFile(exec StepExecutor, target string, content []byte, mode os.FileMode, createParents bool, force bool) (fileInspection, error) {
+	result := fileInspection{}
+	result.targetPath = exec.GetTargetPath(target)
+	result.parentPath = filepath.Dir(result.targetPath)
+
+	fileInfo, err := os.Lstat(result.targetPath)
+	if err == nil {
+		result.exists = true
+		if fileInfo.Mode().IsRegular() {
+			current, err := ioutil.ReadFile(result.targetPath)
+			if err != nil {
+				return result, err
+			}
+			// A file that already has the right content is taken over even if
+			// the state file doesn't know about it, eg. after it was lost
+			if exec.IsTracked(result.targetPath) || bytes.Equal(current, content) {
+				result.changed = !bytes.Equal(current, content)
+				result.wrongMode = fileInfo.Mode().Perm() != mode.Perm()
+				return result, nil
+			}
+		}
+
+		if !force {
+			return result, fmt.Errorf("%s already exists", result.targetPath)
+		}
+		result.blocked = true
+		return result, nil
+
+	} else if !os.IsNotExist(err) {
+		return result, err
+	}
+
+	_, err = os.Stat(result.parentPath)
+	if os.IsNotExist(err) {
+		if !createParents {
+			return result, fmt.Errorf(
+				"Cannot create %s as parent directory %s does not exist",
+				target,
+				result.parentPath,
+			)
+		}
+		result.parentMissing = true
+	} else if err != nil {
+		return result, err
+	}
+
+	return result, nil
+}
+
+func planFile(exec StepExecutor, target string, content []byte, mode os.FileMode, createParents bool, force bool) ([]Change, error) {
+	inspection, err := inspectFile(exec, target, content, mode, createParents, force)
+	if err != nil {
+		return nil, err
+	}
+
+	changes := make([]Change, 0)
+
+	if inspection.blocked {
+		changes = append(changes, NewChange(ChangeReplace, "replace %s with file (%s)", inspection.targetPath, mode.Perm()))
+	} else if !inspection.exists {
+		if inspection.parentMissing {
+			changes = append(changes, NewChange(ChangeCreate, "mkdir %s", inspection.parentPath))
+		}
+		changes = append(changes, NewChange(ChangeCreate, "write %s (%s)", inspection.targetPath, mode.Perm()))
+	} else {
+		if inspection.changed {
+			changes = append(changes, NewChange(ChangeUpdate, "rewrite %s", inspection.targetPath))
+		}
+		if inspection.wrongMode {
+			changes = append(changes, NewChange(ChangeUpdate, "chmod %s %s", mode.Perm(), inspection.targetPath))
+		}
+	}
+
+	return changes, nil
+}
+
+// writeFile puts the content into a file that dotter manages, leaving it alone
+// if it is already correct
+func writeFile(exec StepExecutor, target string, content []byte, mode os.FileMode, createParents bool, force bool) (Result, error) {
+	inspection, err := inspectFile(exec, target, content, mode, createParents, force)
+	if err != nil {
+		return Result{}, err
+	}
+
+	result := NewResult(ResultUnchanged, "already up to date")
+
+	if inspection.blocked {
+		err = exec.ForceRemove(inspection.targetPath)
+		if err != nil {
+			return Result{}, err
+		}
+		result = NewResult(ResultReplaced, "replaced with file")
+	} else if inspection.parentMissing {
+		err = os.MkdirAll(inspection.parentPath, os.FileMode(0o777))
+		if err != nil {
+			return Result{}, err
+		}
+	}
+
+	written := !inspection.exists || inspection.blocked || inspection.changed
+	if written {
+		err = ioutil.WriteFile(inspection.targetPath, content, mode)
+		if err != nil {
+			return Result{}, err
+		}
+	}
+	exec.Track(TrackedFile, inspection.targetPath, "")
+
+	if !inspection.exists {
+		result = NewResult(ResultCreated, "written")
+	} else if inspection.changed {
+		result = NewResult(ResultUpdated, "rewritten")
+	} else if inspection.wrongMode && !inspection.blocked {
+		result = NewResult(ResultUpdated, "changed mode to %s", mode.Perm())
+	}
+
+	if written || inspection.wrongMode {
+		err = os.Chmod(inspection.targetPath, mode)
+		if err != nil {
+			return Result{}, err
+		}
+	}
+	return result, nil
+}
+
+// removeFile removes a file that dotter wrote, and then restores whatever it replaced
+func removeFile(exec StepExecutor, target string) error {
+	targetPath := exec.GetTargetPath(target)
+	if !exec.IsTracked(targetPath) {
+		return nil
+	}
+
+	err := os.Remove(targetPath)
+	if err == nil {
+		exec.PrintInfo(fmt.Sprintf("Removed %s", targetPath))
+	} else if !os.IsNotExist(err) {
+		return err
+	}
+	exec.Untrack(targetPath)
+
+	_, err = exec.RestoreBackup(targetPath)
+	return err
+}
+
+// fileEdit describes a change made to the lines of a file that dotter doesn't
+// own, both as it is planned and as it is reported once made
+type fileEdit struct {
+	lines   []string
+	planned string
+	done    string
+}
+
+type editInspection struct {
+	targetPath    string
+	parentPath    string
+	exists        bool
+	parentMissing bool
+	mode          os.FileMode
+	newline       bool
+	edit          fileEdit
+}
+
+func splitLines(content string) []string {
+	if content == "" {
+		return []string{}
+	}
+	return strings.Split(strings.TrimSuffix(content, "\n"), "\n")
+}
+
+// joinLines puts the lines back together, only ending the last one with a
+// newline if the file did so before
+func joinLines(lines []string, newline bool) []byte {
+	if len(lines) == 0 {
+		return []byte{}
+	}
+	content := strings.Join(lines, "\n")
+	if newline {
+		content += "\n"
+	}
+	return []byte(content)
+}
+
+// inspectEdit works out what the specified edit would do to a file that dotter
+// doesn't own; an edit with no description means there is nothing to do
+func inspectEdit(exec StepExecutor, target string, create bool, edit func([]string) (fileEdit, error)) (editInspection, error) {
+	result := editInspection{}
+	result.targetPath = exec.GetTargetPath(target)
+	result.mode = os.FileMode(0o644)
+	result.newline = true
+
+	// Edit what a link points to rather than replacing the link, unless it is
+	// one of dotter's, as the edit would then end up in the source directory
+	resolved, err := filepath.EvalSymlinks(result.targetPath)
+	if err == nil {
+		sourcePath, err := filepath.EvalSymlinks(exec.GetSourcePath(""))
+		if err != nil {
+			sourcePath = exec.GetSourcePath("")
+		}
+		if IsWithin(resolved, sourcePath) {
+			return result, fmt.Errorf("%s links to %s in the source directory", result.targetPath, resolved)
+		}
+		result.targetPath = resolved
+	}
+	result.parentPath = filepath.Dir(result.targetPath)
+
+	lines := []string{}
+	fileInfo, err := os.Stat(result.targetPath)
+	if err == nil {
+		if !fileInfo.Mode().IsRegular() {
+			return result, fmt.Errorf("%s is not a file", result.targetPath)
+		}
+		result.exists = true
+		result.mode = fileInfo.Mode().Perm()
+
+		content, err := ioutil.ReadFile(result.targetPath)
+		if err != nil {
+			return result, err
+		}
+		lines = splitLines(string(content))
+		result.newline = len(content) == 0 || content[len(content)-1] == '\n'
+
+	} else if !os.IsNotExist(err) {
+		return result, err
+	}
+
+	result.edit, err = edit(lines)
+	if err != nil {
+		return result, err
+	}
+	if result.exists || result.edit.planned == "" {
+		return result, nil
+	}
+
+	if !create {
+		return result, fmt.Errorf("%s does not exist", result.targetPath)
+	}
+	_, err = os.Stat(result.parentPath)
+	if os.IsNotExist(err) {
+		result.parentMissing = true
+	} else if err != nil {
+		return result, err
+	}
+
+	return result, nil
+}
+
+func planEdit(exec StepExecutor, target string, create bool, edit func([]string) (fileEdit, error)) ([]Change, error) {
+	inspection, err := inspectEdit(exec, target, create, edit)
+	if err != nil {
+		return nil, err
+	}
+
+	changes := make([]Change, 0)
+
+	if inspection.edit.planned == "" {
+		return changes, nil
+	} else if !inspection.exists {
+		if inspection.parentMissing {
+			changes = append(changes, NewChange(ChangeCreate, "mkdir %s", inspection.parentPath))
+		}
+		changes = append(changes, NewChange(ChangeCreate, "write %s to %s", inspection.edit.planned, inspection.targetPath))
+	} else {
+		changes = append(changes, NewChange(ChangeUpdate, "%s in %s", inspection.edit.planned, inspection.targetPath))
+	}
+
+	return changes, nil
+}
+
+// applyEdit makes the specified edit to a file that dotter doesn't own, handing
+// the original to ForceRemove so that it is backed up
+func applyEdit(exec StepExecutor, target string, create bool, edit func([]string) (fileEdit, error)) (Result, error) {
+	inspection, err := inspectEdit(exec, target, create, edit)
+	if err != nil {
+		return Result{}, err
+	}
+
+	if inspection.edit.planned == "" {
+		return NewResult(ResultUnchanged, "already up to date"), nil
+	}
+
+	if inspection.parentMissing {
+		err = os.MkdirAll(inspection.parentPath, os.FileMode(0o777))
+		if err != nil {
+			return Result{}, err
+		}
+	}
+
+	err = replaceFile(exec, inspection, joinLines(inspection.edit.lines, inspection.newline))
+	if err != nil {
+		return Result{}, err
+	}
+
+	if !inspection.exists {
+		return NewResult(ResultCreated, "written with %s", inspection.edit.done), nil
+	}
+	return NewResult(ResultUpdated, "%s", inspection.edit.done), nil
+}
+
+// replaceFile writes the edited content next to the file first, so that the
+// original is only removed once there is something to take its place
+func replaceFile(exec StepExecutor, inspection editInspection, content []byte) error {
+	temp, err := ioutil.TempFile(inspection.parentPath, "."+filepath.Base(inspection.targetPath)+".dotter-")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(temp.Name())
+
+	_, err = temp.Write(content)
+	if err == nil {
+		err = temp.Chmod(inspection.mode)
+	}
+	closeErr := temp.Close()
+	if err != nil {
+		return err
+	} else if closeErr != nil {
+		return closeErr
+	}
+
+	if inspection.exists {
+		err = exec.ForceRemove(inspection.targetPath)
+		if err != nil {
+			return err
+		}
+	}
+	return os.Rename(temp.Name(), inspection.targetPath)
+}
+
+// insertLines puts the new lines before the first line matching the before
+// expression, or after the last line matching the after expression; BOF and
+// EOF refer to the start and end of the file, and the end of the file is used
+// when neither matches
+func insertLines(lines []string, insert []string, before string, after string) ([]string, error) {
+	position := len(lines)
+
+	if before == "BOF" {
+		position = 0
+	} else if before != "" {
+		pattern, err := regexp.Compile(before)
+		if err != nil {
+			return nil, fmt.Errorf("Invalid insert_before expression: %s", err)
+		}
+		for idx, line := range lines {
+			if pattern.MatchString(line) {
+				position = idx
+				break
+			}
+		}
+	} else if after != "" && after != "EOF" {
+		pattern, err := regexp.Compile(after)
+		if err != nil {
+			return nil, fmt.Errorf("Invalid insert_after expression: %s", err)
+		}
+		for idx := len(lines) - 1; idx >= 0; idx-- {
+			if pattern.MatchString(lines[idx]) {
+				position = idx + 1
+				break
+			}
+		}
+	}
+
+	result := make([]string, 0, len(lines)+len(insert))
+	result = append(result, lines[:position]...)
+	result = append(result, insert...)
+	result = append(result, lines[position:]...)
+	return result, nil
+}
+
+func checkState(state string) error {
+	if state != "present" && state != "absent" {
+		return fmt.Errorf("Unknown state \"%s\", expected \"present\" or \"absent\"", state)
+	}
+	return nil
+}
@@ -0,0 +1,471 @@
+package step
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	osexec "os/exec"
+	"path/filepath"
+	"strings"
+)
+
+// GitOptions contains non-repository options for Git steps
+type GitOptions struct {
+	CreateParents bool `yaml:"create_parents"`
+	Depth         int
+	Update        string
+	Force         bool
+}
+
+// NewGitOptions creates a new instance of a GitOptions struct
+func NewGitOptions() GitOptions {
+	opt := GitOptions{}
+	opt.CreateParents = true
+	opt.Depth = 0
+	opt.Update = "always"
+	opt.Force = false
+	return opt
+}
+
+// GitStep contains the specification for Git steps
+type GitStep struct {
+	GitOptions `yaml:",inline"`
+	StepMeta   `yaml:",inline"`
+	Target     string
+	URL        string `yaml:"url"`
+	Ref        string
+}
+
+// NewGitStep creates a new instance of a GitStep struct using default options
+func NewGitStep() GitStep {
+	return NewGitStepWithDefaults(NewGitOptions())
+}
+
+// NewGitStepWithDefaults creates a new instance of a GitStep struct using the specified options
+func NewGitStepWithDefaults(defaults GitOptions) GitStep {
+	step := GitStep{}
+	step.GitOptions = defaults
+	return step
+}
+
+// GetActivityLabel returns a short description of what a GitStep does
+func (step GitStep) GetActivityLabel() string {
+	return "Repository"
+}
+
+// GetActivityDetails returns description specific to this particular instance of the GitStep
+func (step GitStep) GetActivityDetails() string {
+	return step.Target
+}
+
+type gitState int
+
+const (
+	gitMissing gitState = iota
+	gitMissingParent
+	gitBlocked
+	gitCurrent
+	gitBehind
+	gitFrozen
+	gitSwitch
+)
+
+type gitInspection struct {
+	state      gitState
+	targetPath string
+	parentPath string
+	head       string
+	remote     string
+	isBranch   bool
+}
+
+func (step GitStep) inspect(exec StepExecutor) (gitInspection, error) {
+	result := gitInspection{}
+	result.targetPath = exec.GetTargetPath(step.Target)
+	result.parentPath = filepath.Dir(result.targetPath)
+
+	if step.Update != "always" && step.Update != "never" {
+		return result, fmt.Errorf(
+			"Unknown update policy \"%s\", expected \"always\" or \"never\"",
+			step.Update,
+		)
+	}
+
+	fileInfo, err := os.Lstat(result.targetPath)
+	if os.IsNotExist(err) {
+		_, err = os.Stat(result.parentPath)
+		if os.IsNotExist(err) {
+			if !step.CreateParents {
+				return result, fmt.Errorf(
+					"Cannot create %s as parent directory %s does not exist",
+					step.Target,
+					result.parentPath,
+				)
+			}
+			result.state = gitMissingParent
+			return result, nil
+		} else if err != nil {
+			return result, err
+		}
+		result.state = gitMissing
+		return result, nil
+	} else if err != nil {
+		return result, err
+	}
+
+	if !fileInfo.IsDir() || !isGitRepository(result.targetPath) {
+		if !step.Force {
+			return result, fmt.Errorf("Non-repository %s already exists", result.targetPath)
+		}
+		result.state = gitBlocked
+		return result, nil
+	}
+
+	// A repository cloned from somewhere else is in the way just the same
+	origin, err := runGit(result.targetPath, "remote", "get-url", "origin")
+	if err != nil || origin != step.URL {
+		if !step.Force {
+			return result, fmt.Errorf("Repository %s is not a clone of %s", result.targetPath, step.URL)
+		}
+		result.state = gitBlocked
+		return result, nil
+	}
+
+	result.head, err = runGit(result.targetPath, "rev-parse", "HEAD")
+	if err != nil {
+		return result, err
+	}
+	if step.Update == "never" {
+		result.state = gitFrozen
+		return result, nil
+	}
+
+	if step.isCommit() {
+		result.remote = strings.ToLower(step.Ref)
+	} else {
+		result.remote, result.isBranch, err = step.findRemoteCommit(result.targetPath)
+		if err != nil {
+			return result, err
+		}
+	}
+
+	if step.Ref != "" && !step.isCommit() {
+		// The ref may have changed since the repository was cloned; merging it
+		// into whatever is checked out would mix the two up
+		current, _ := runGit(result.targetPath, "symbolic-ref", "--quiet", "--short", "HEAD")
+		if result.isBranch && current != step.Ref || !result.isBranch && result.head != result.remote {
+			result.state = gitSwitch
+			return result, nil
+		}
+	}
+
+	if result.remote == result.head {
+		result.state = gitCurrent
+	} else {
+		result.state = gitBehind
+	}
+
+	return result, nil
+}
+
+// isCommit determines whether the ref is a full commit ID rather than the
+// name of a branch or tag
+func (step GitStep) isCommit() bool {
+	if len(step.Ref) != 40 && len(step.Ref) != 64 {
+		return false
+	}
+	for _, char := range strings.ToLower(step.Ref) {
+		if !strings.ContainsRune("0123456789abcdef", char) {
+			return false
+		}
+	}
+	return true
+}
+
+// findRemoteCommit asks the origin what commit the ref (or, if there isn't
+// one, the upstream branch) currently points to, without fetching anything,
+// and whether that ref is a branch rather than a tag
+func (step GitStep) findRemoteCommit(repoPath string) (string, bool, error) {
+	args := []string{"ls-remote", "origin"}
+	branch, tag := "", ""
+	if step.Ref == "" {
+		upstream, err := runGit(repoPath, "rev-parse", "--abbrev-ref", "--symbolic-full-name", "@{upstream}")
+		if err != nil {
+			return "", false, err
+		}
+		branch = "refs/heads/" + strings.TrimPrefix(upstream, "origin/")
+		args = append(args, branch)
+	} else {
+		branch, tag = "refs/heads/"+step.Ref, "refs/tags/"+step.Ref
+		args = append(args, branch, tag)
+	}
+
+	output, err := runGit(repoPath, args...)
+	if err != nil {
+		return "", false, err
+	}
+
+	commits := make(map[string]string)
+	for _, line := range strings.Split(output, "\n") {
+		fields := strings.Fields(line)
+		if len(fields) != 2 {
+			continue
+		}
+		name := strings.TrimSuffix(fields[1], "^{}")
+		if _, ok := commits[name]; !ok || name != fields[1] {
+			// Annotated tags are listed twice; the peeled one is the commit
+			commits[name] = fields[0]
+		}
+	}
+
+	if commit, ok := commits[branch]; ok {
+		return commit, true, nil
+	} else if commit, ok := commits[tag]; ok && tag != "" {
+		return commit, false, nil
+	}
+	return "", false, fmt.Errorf("Could not find %s in %s", strings.TrimPrefix(branch, "refs/heads/"), step.URL)
+}
+
+// Plan describes the changes that Execute would make to clone or update the repository
+func (step GitStep) Plan(exec StepExecutor) ([]Change, error) {
+	inspection, err := step.inspect(exec)
+	if err != nil {
+		return nil, err
+	}
+
+	changes := make([]Change, 0)
+
+	switch inspection.state {
+	case gitMissingParent:
+		changes = append(changes, NewChange(ChangeCreate, "mkdir %s", inspection.parentPath))
+		changes = append(changes, NewChange(ChangeCreate, "clone %s -> %s", step.URL, inspection.targetPath))
+	case gitMissing:
+		changes = append(changes, NewChange(ChangeCreate, "clone %s -> %s", step.URL, inspection.targetPath))
+	case gitBlocked:
+		changes = append(changes, NewChange(ChangeReplace, "replace %s with clone of %s", inspection.targetPath, step.URL))
+	case gitSwitch:
+		changes = append(changes, NewChange(
+			ChangeUpdate,
+			"check out %s at %s in %s",
+			step.Ref,
+			shortCommit(inspection.remote),
+			inspection.targetPath,
+		))
+	case gitBehind:
+		if step.isCommit() {
+			changes = append(changes, NewChange(
+				ChangeUpdate,
+				"check out %s in %s",
+				shortCommit(inspection.remote),
+				inspection.targetPath,
+			))
+			break
+		}
+		changes = append(changes, NewChange(
+			ChangeUpdate,
+			"fast-forward %s from %s to %s",
+			inspection.targetPath,
+			shortCommit(inspection.head),
+			shortCommit(inspection.remote),
+		))
+	}
+
+	return changes, nil
+}
+
+// Execute clones the repository if it is missing, or fast-forwards it if it
+// is behind
+func (step GitStep) Execute(exec StepExecutor) (Result, error) {
+	inspection, err := step.inspect(exec)
+	if err != nil {
+		return Result{}, err
+	}
+
+	switch inspection.state {
+	case gitCurrent:
+		return NewResult(ResultUnchanged, "already up to date at %s", shortCommit(inspection.head)), nil
+
+	case gitFrozen:
+		return NewResult(ResultUnchanged, "already cloned at %s, not updating", shortCommit(inspection.head)), nil
+
+	case gitSwitch:
+		return step.switchRef(inspection)
+
+	case gitBehind:
+		if step.isCommit() {
+			err = step.checkoutCommit(inspection.targetPath)
+			if err != nil {
+				return Result{}, err
+			}
+			return NewResult(ResultUpdated, "checked out %s, was at %s", shortCommit(inspection.remote), shortCommit(inspection.head)), nil
+		}
+		return step.fastForward(inspection)
+
+	case gitBlocked:
+		err = exec.ForceRemove(inspection.targetPath)
+		if err != nil {
+			return Result{}, err
+		}
+
+	case gitMissingParent:
+		err = os.MkdirAll(inspection.parentPath, os.FileMode(0o777))
+		if err != nil {
+			return Result{}, err
+		}
+	}
+
+	args := []string{"clone", "--quiet"}
+	if step.Depth > 0 {
+		args = append(args, "--depth", fmt.Sprint(step.Depth))
+	}
+	if step.isCommit() {
+		// Commits can't be cloned directly, so they're checked out afterwards
+		args = append(args, "--no-checkout")
+	} else if step.Ref != "" {
+		args = append(args, "--branch", step.Ref)
+	}
+	args = append(args, "--", step.URL, inspection.targetPath)
+	_, err = runGit(inspection.parentPath, args...)
+	if err != nil {
+		return Result{}, err
+	}
+	if step.isCommit() {
+		err = step.checkoutCommit(inspection.targetPath)
+		if err != nil {
+			return Result{}, err
+		}
+	}
+
+	head, err := runGit(inspection.targetPath, "rev-parse", "HEAD")
+	if err != nil {
+		return Result{}, err
+	}
+	if inspection.state == gitBlocked {
+		return NewResult(ResultReplaced, "replaced with clone at %s", shortCommit(head)), nil
+	}
+	return NewResult(ResultCreated, "cloned at %s", shortCommit(head)), nil
+}
+
+// fetchArgs returns the arguments to fetch the ref from the origin, or
+// everything the origin has if no ref is given
+func (step GitStep) fetchArgs(ref string) []string {
+	args := []string{"fetch", "--quiet"}
+	if step.Depth > 0 {
+		args = append(args, "--depth", fmt.Sprint(step.Depth))
+	}
+	args = append(args, "origin")
+	if ref != "" {
+		args = append(args, ref)
+	}
+	return args
+}
+
+// checkoutCommit detaches the repository at the commit in the ref, fetching
+// it first if the repository doesn't have it yet
+func (step GitStep) checkoutCommit(repoPath string) error {
+	_, err := runGit(repoPath, "cat-file", "-e", step.Ref+"^{commit}")
+	if err != nil {
+		_, err = runGit(repoPath, step.fetchArgs(step.Ref)...)
+		if err != nil {
+			return err
+		}
+	}
+	_, err = runGit(repoPath, "checkout", "--quiet", "--detach", step.Ref)
+	return err
+}
+
+// switchRef checks out the ref in a repository that is on something else:
+// a branch as the local branch of the same name, and a tag detached
+func (step GitStep) switchRef(inspection gitInspection) (Result, error) {
+	_, err := runGit(inspection.targetPath, step.fetchArgs(step.Ref)...)
+	if err != nil {
+		return Result{}, err
+	}
+
+	_, err = runGit(inspection.targetPath, "rev-parse", "--verify", "--quiet", "refs/heads/"+step.Ref)
+	hasBranch := err == nil
+
+	if !inspection.isBranch {
+		_, err = runGit(inspection.targetPath, "checkout", "--quiet", "--detach", "FETCH_HEAD")
+	} else if !hasBranch {
+		_, err = runGit(inspection.targetPath, "checkout", "--quiet", "-b", step.Ref, "FETCH_HEAD")
+	} else {
+		// Anything committed to the branch locally is kept, as with updates
+		_, err = runGit(inspection.targetPath, "checkout", "--quiet", step.Ref)
+		if err == nil {
+			_, err = runGit(inspection.targetPath, "merge", "--quiet", "--ff-only", "FETCH_HEAD")
+		}
+	}
+	if err != nil {
+		return Result{}, err
+	}
+
+	head, err := runGit(inspection.targetPath, "rev-parse", "HEAD")
+	if err != nil {
+		return Result{}, err
+	}
+	return NewResult(ResultUpdated, "checked out %s at %s", step.Ref, shortCommit(head)), nil
+}
+
+func (step GitStep) fastForward(inspection gitInspection) (Result, error) {
+	mergeRef := "@{upstream}"
+	if step.Ref != "" {
+		mergeRef = "FETCH_HEAD"
+	}
+
+	_, err := runGit(inspection.targetPath, step.fetchArgs(step.Ref)...)
+	if err != nil {
+		return Result{}, err
+	}
+	_, err = runGit(inspection.targetPath, "merge", "--quiet", "--ff-only", mergeRef)
+	if err != nil {
+		return Result{}, err
+	}
+
+	head, err := runGit(inspection.targetPath, "rev-parse", "HEAD")
+	if err != nil {
+		return Result{}, err
+	}
+	if head == inspection.head {
+		// The local copy is ahead of the remote
+		return NewResult(ResultUnchanged, "already up to date at %s", shortCommit(head)), nil
+	}
+	return NewResult(ResultUpdated, "fast-forwarded from %s to %s", shortCommit(inspection.head), shortCommit(head)), nil
+}
+
+func isGitRepository(path string) bool {
+	_, err := os.Stat(filepath.Join(path, ".git"))
+	return err == nil
+}
+
+func shortCommit(commit string) string {
+	if len(commit) > 7 {
+		return commit[:7]
+	}
+	return commit
+}
+
+// runGit runs git in the specified directory, returning what it printed
+func runGit(dir string, args ...string) (string, error) {
+	cmd := osexec.Command("git", args...)
+	cmd.Dir = dir
+	cmd.Stdin = nil
+	// Never wait for credentials that nobody is going to type
+	cmd.Env = append(os.Environ(), "GIT_TERMINAL_PROMPT=0")
+
+	var stdout bytes.Buffer
+	cmd.Stdout = &stdout
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+
+	err := cmd.Run()
+	if err != nil {
+		message := strings.TrimSpace(stderr.String())
+		if message == "" {
+			message = err.Error()
+		}
+		return "", fmt.Errorf("git %s failed: %s", args[0], message)
+	}
+
+	return strings.TrimSpace(stdout.String()), nil
+}
@@ -0,0 +1,280 @@
+package step_test
+
+import (
+	"os"
+	osexec "os/exec"
+	"path/filepath"
+	"strings"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	"github.com/jayclassless/dotter/step"
+)
+
+func git(dir string, args ...string) string {
+	args = append([]string{"-c", "user.name=Dotter", "-c", "user.email=dotter@example.com"}, args...)
+	cmd := osexec.Command("git", args...)
+	cmd.Dir = dir
+	output, err := cmd.CombinedOutput()
+	Expect(err).Should(Succeed(), string(output))
+	return strings.TrimSpace(string(output))
+}
+
+var _ = Describe("GitStep", func() {
+	Describe("NewGitStep", func() {
+		It("Works", func() {
+			Expect(step.NewGitStep()).ShouldNot(BeNil())
+		})
+	})
+
+	Describe("GetActivityLabel", func() {
+		It("Works", func() {
+			Expect(step.NewGitStep().GetActivityLabel()).To(Equal("Repository"))
+		})
+	})
+
+	Describe("GetActivityDetails", func() {
+		It("Works", func() {
+			step := step.NewGitStep()
+			step.Target = "foobar"
+
+			Expect(step.GetActivityDetails()).To(Equal("foobar"))
+		})
+	})
+
+	Describe("Execute", func() {
+		var executor *TestExecutor
+		var remote string
+		var work string
+
+		commit := func(file string) string {
+			writeFile(work, file, file)
+			git(work, "add", file)
+			git(work, "commit", "--quiet", "-m", file)
+			git(work, "push", "--quiet", "origin", "HEAD:main")
+			return git(work, "rev-parse", "HEAD")
+		}
+
+		BeforeEach(func() {
+			executor = NewTestExecutor(tmpdir(), tmpdir())
+			remote = mkdir(executor.source, "remote.git")
+			git(remote, "init", "--quiet", "--bare", "--initial-branch=main")
+			work = mkdir(executor.source, "work")
+			git(work, "init", "--quiet", "--initial-branch=main")
+			git(work, "remote", "add", "origin", remote)
+			commit("one")
+		})
+
+		AfterEach(func() {
+			rmdir(executor.target)
+			rmdir(executor.source)
+		})
+
+		It("Clones missing repositories", func() {
+			s := step.NewGitStep()
+			s.Target = "plugins/repo"
+			s.URL = remote
+
+			changes, err := s.Plan(executor)
+			Expect(err).Should(Succeed())
+			Expect(changes).To(HaveLen(2))
+			Expect(changes[1].Type).To(Equal(step.ChangeCreate))
+
+			Expect(s.Execute(executor)).To(haveStatus("created"))
+			Expect(executor.GetTargetPath("plugins/repo/one")).To(BeAnExistingFile())
+		})
+
+		It("Leaves current repositories alone", func() {
+			s := step.NewGitStep()
+			s.Target = "repo"
+			s.URL = remote
+			Expect(s.Execute(executor)).To(haveStatus("created"))
+
+			changes, err := s.Plan(executor)
+			Expect(err).Should(Succeed())
+			Expect(changes).To(HaveLen(0))
+			Expect(s.Execute(executor)).To(haveStatus("unchanged"))
+		})
+
+		It("Fast-forwards repositories that are behind", func() {
+			s := step.NewGitStep()
+			s.Target = "repo"
+			s.URL = remote
+			Expect(s.Execute(executor)).To(haveStatus("created"))
+			head := commit("two")
+
+			changes, err := s.Plan(executor)
+			Expect(err).Should(Succeed())
+			Expect(changes).To(HaveLen(1))
+			Expect(changes[0].Type).To(Equal(step.ChangeUpdate))
+
+			Expect(s.Execute(executor)).To(haveStatus("updated"))
+			Expect(git(executor.GetTargetPath("repo"), "rev-parse", "HEAD")).To(Equal(head))
+		})
+
+		It("Follows the specified ref with a shallow clone", func() {
+			commit("two")
+			git(work, "push", "--quiet", "origin", "HEAD:stable")
+			commit("three")
+
+			s := step.NewGitStep()
+			s.Target = "repo"
+			s.URL = "file://" + remote
+			s.Ref = "stable"
+			s.Depth = 1
+			Expect(s.Execute(executor)).To(haveStatus("created"))
+			Expect(executor.GetTargetPath("repo/two")).To(BeAnExistingFile())
+			Expect(executor.GetTargetPath("repo/three")).ToNot(BeAnExistingFile())
+			Expect(git(executor.GetTargetPath("repo"), "rev-list", "--count", "HEAD")).To(Equal("1"))
+			Expect(s.Execute(executor)).To(haveStatus("unchanged"))
+		})
+
+		It("Checks out the specified commit", func() {
+			first := git(work, "rev-parse", "HEAD")
+			second := commit("two")
+			commit("three")
+
+			s := step.NewGitStep()
+			s.Target = "repo"
+			s.URL = "file://" + remote
+			s.Ref = first
+			s.Depth = 1
+			Expect(s.Execute(executor)).To(haveStatus("created"))
+			Expect(git(executor.GetTargetPath("repo"), "rev-parse", "HEAD")).To(Equal(first))
+			Expect(executor.GetTargetPath("repo/two")).ToNot(BeAnExistingFile())
+			Expect(s.Execute(executor)).To(haveStatus("unchanged"))
+
+			s.Ref = second
+			changes, err := s.Plan(executor)
+			Expect(err).Should(Succeed())
+			Expect(changes).To(HaveLen(1))
+			Expect(changes[0].Description).To(HavePrefix("check out " + second[:7]))
+			Expect(s.Execute(executor)).To(haveStatus("updated"))
+			Expect(git(executor.GetTargetPath("repo"), "rev-parse", "HEAD")).To(Equal(second))
+		})
+
+		It("Fails on repositories cloned from elsewhere when Force is disabled", func() {
+			s := step.NewGitStep()
+			s.Target = "repo"
+			s.URL = remote
+			Expect(s.Execute(executor)).To(haveStatus("created"))
+
+			s.URL = "file://" + remote
+			_, err := s.Execute(executor)
+			Expect(err).To(MatchError(ContainSubstring("is not a clone of file://")))
+		})
+
+		It("Replaces repositories cloned from elsewhere when Force is enabled", func() {
+			s := step.NewGitStep()
+			s.Target = "repo"
+			s.URL = remote
+			Expect(s.Execute(executor)).To(haveStatus("created"))
+
+			s.URL = "file://" + remote
+			s.Force = true
+			Expect(s.Execute(executor)).To(haveStatus("replaced"))
+			Expect(executor.backedUp).To(HaveLen(1))
+			Expect(git(executor.GetTargetPath("repo"), "remote", "get-url", "origin")).To(Equal(s.URL))
+		})
+
+		It("Checks out the ref when it changes", func() {
+			first := git(work, "rev-parse", "HEAD")
+			git(work, "tag", "v1")
+			git(work, "push", "--quiet", "origin", "v1")
+			writeFile(work, "two", "two")
+			git(work, "add", "two")
+			git(work, "commit", "--quiet", "-m", "two")
+			git(work, "push", "--quiet", "origin", "HEAD:dev")
+			dev := git(work, "rev-parse", "HEAD")
+
+			s := step.NewGitStep()
+			s.Target = "repo"
+			s.URL = remote
+			s.Ref = "main"
+			Expect(s.Execute(executor)).To(haveStatus("created"))
+			repo := executor.GetTargetPath("repo")
+
+			s.Ref = "dev"
+			changes, err := s.Plan(executor)
+			Expect(err).Should(Succeed())
+			Expect(changes).To(HaveLen(1))
+			Expect(changes[0].Description).To(HavePrefix("check out dev at " + dev[:7]))
+			Expect(s.Execute(executor)).To(haveStatus("updated"))
+			Expect(git(repo, "symbolic-ref", "--short", "HEAD")).To(Equal("dev"))
+			Expect(git(repo, "rev-parse", "HEAD")).To(Equal(dev))
+			Expect(git(repo, "rev-parse", "main")).To(Equal(first))
+			Expect(s.Execute(executor)).To(haveStatus("unchanged"))
+
+			s.Ref = "main"
+			Expect(s.Execute(executor)).To(haveStatus("updated"))
+			Expect(git(repo, "symbolic-ref", "--short", "HEAD")).To(Equal("main"))
+			Expect(git(repo, "rev-parse", "HEAD")).To(Equal(first))
+
+			s.Ref = "v1"
+			git(repo, "checkout", "--quiet", "dev")
+			Expect(s.Execute(executor)).To(haveStatus("updated"))
+			Expect(git(repo, "rev-parse", "HEAD")).To(Equal(first))
+			Expect(s.Execute(executor)).To(haveStatus("unchanged"))
+		})
+
+		It("Does not update when configured not to", func() {
+			s := step.NewGitStep()
+			s.Target = "repo"
+			s.URL = remote
+			s.Update = "never"
+			Expect(s.Execute(executor)).To(haveStatus("created"))
+			commit("two")
+
+			changes, err := s.Plan(executor)
+			Expect(err).Should(Succeed())
+			Expect(changes).To(HaveLen(0))
+			Expect(s.Execute(executor)).To(haveStatus("unchanged"))
+			Expect(executor.GetTargetPath("repo/two")).ToNot(BeAnExistingFile())
+		})
+
+		It("Fails on unknown update policies", func() {
+			s := step.NewGitStep()
+			s.Target = "repo"
+			s.URL = remote
+			s.Update = "sometimes"
+
+			_, err := s.Execute(executor)
+			Expect(err).To(MatchError(ContainSubstring("Unknown update policy \"sometimes\"")))
+		})
+
+		It("Fails on collisions when Force is disabled", func() {
+			mkdir(executor.target, "repo")
+			writeFile(executor.target, "repo/mine", "mine")
+			s := step.NewGitStep()
+			s.Target = "repo"
+			s.URL = remote
+
+			_, err := s.Execute(executor)
+			Expect(err).Should(HaveOccurred())
+			Expect(executor.GetTargetPath("repo/mine")).To(BeAnExistingFile())
+		})
+
+		It("Handles collisions when Force is enabled", func() {
+			mkdir(executor.target, "repo")
+			s := step.NewGitStep()
+			s.Target = "repo"
+			s.URL = remote
+			s.Force = true
+
+			Expect(s.Execute(executor)).To(haveStatus("replaced"))
+			Expect(executor.backedUp).To(HaveLen(1))
+			_, err := os.Stat(filepath.Join(executor.GetTargetPath("repo"), ".git"))
+			Expect(err).Should(Succeed())
+		})
+
+		It("Reports errors from git", func() {
+			s := step.NewGitStep()
+			s.Target = "repo"
+			s.URL = filepath.Join(executor.source, "missing.git")
+
+			_, err := s.Execute(executor)
+			Expect(err).To(MatchError(ContainSubstring("git clone failed")))
+		})
+	})
+})
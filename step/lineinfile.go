@@ -0,0 +1,135 @@
+package step
+
+import (
+	"fmt"
+	"regexp"
+)
+
+// LineInFileOptions contains non-content options for LineInFile steps
+type LineInFileOptions struct {
+	Create bool
+	State  string
+}
+
+// NewLineInFileOptions creates a new instance of a LineInFileOptions struct
+func NewLineInFileOptions() LineInFileOptions {
+	opt := LineInFileOptions{}
+	opt.Create = true
+	opt.State = "present"
+	return opt
+}
+
+// LineInFileStep contains the specification for LineInFile steps
+type LineInFileStep struct {
+	LineInFileOptions `yaml:",inline"`
+	StepMeta          `yaml:",inline"`
+	Target            string
+	Line              string
+	Regexp            string
+	InsertBefore      string `yaml:"insert_before"`
+	InsertAfter       string `yaml:"insert_after"`
+}
+
+// NewLineInFileStep creates a new instance of a LineInFileStep struct using default options
+func NewLineInFileStep() LineInFileStep {
+	return NewLineInFileStepWithDefaults(NewLineInFileOptions())
+}
+
+// NewLineInFileStepWithDefaults creates a new instance of a LineInFileStep struct using the specified options
+func NewLineInFileStepWithDefaults(defaults LineInFileOptions) LineInFileStep {
+	step := LineInFileStep{}
+	step.LineInFileOptions = defaults
+	return step
+}
+
+// GetActivityLabel returns a short description of what a LineInFileStep does
+func (step LineInFileStep) GetActivityLabel() string {
+	return "Editing"
+}
+
+// GetActivityDetails returns description specific to this particular instance of the LineInFileStep
+func (step LineInFileStep) GetActivityDetails() string {
+	return step.Target
+}
+
+// matcher returns whether a line is the one this step manages: one matching
+// the regular expression if there is one, otherwise the line itself
+func (step LineInFileStep) matcher() (func(string) bool, error) {
+	if step.Regexp == "" {
+		return func(line string) bool {
+			return line == step.Line
+		}, nil
+	}
+
+	pattern, err := regexp.Compile(step.Regexp)
+	if err != nil {
+		return nil, fmt.Errorf("Invalid regexp: %s", err)
+	}
+	return pattern.MatchString, nil
+}
+
+func (step LineInFileStep) edit(lines []string) (fileEdit, error) {
+	err := checkState(step.State)
+	if err != nil {
+		return fileEdit{}, err
+	}
+	matches, err := step.matcher()
+	if err != nil {
+		return fileEdit{}, err
+	}
+
+	if step.State == "absent" {
+		kept := make([]string, 0, len(lines))
+		for _, line := range lines {
+			if !matches(line) {
+				kept = append(kept, line)
+			}
+		}
+		removed := len(lines) - len(kept)
+		if removed == 0 {
+			return fileEdit{}, nil
+		}
+		return fileEdit{
+			lines:   kept,
+			planned: fmt.Sprintf("remove %d line(s)", removed),
+			done:    fmt.Sprintf("removed %d line(s)", removed),
+		}, nil
+	}
+
+	if step.Line == "" {
+		return fileEdit{}, fmt.Errorf("No line specified for %s", step.Target)
+	}
+
+	for _, line := range lines {
+		if line == step.Line {
+			return fileEdit{}, nil
+		}
+	}
+
+	if step.Regexp != "" {
+		// Replace the last line that matches, like sed would leave it
+		for idx := len(lines) - 1; idx >= 0; idx-- {
+			if matches(lines[idx]) {
+				edited := append([]string{}, lines...)
+				edited[idx] = step.Line
+				return fileEdit{lines: edited, planned: "replace line", done: "replaced line"}, nil
+			}
+		}
+	}
+
+	edited, err := insertLines(lines, []string{step.Line}, step.InsertBefore, step.InsertAfter)
+	if err != nil {
+		return fileEdit{}, err
+	}
+	return fileEdit{lines: edited, planned: "add line", done: "added line"}, nil
+}
+
+// Plan describes the changes that Execute would make to the file
+func (step LineInFileStep) Plan(exec StepExecutor) ([]Change, error) {
+	return planEdit(exec, step.Target, step.Create, step.edit)
+}
+
+// Execute makes sure the line is present in, or absent from, the file
+func (step LineInFileStep) Execute(exec StepExecutor) (Result, error) {
+	return applyEdit(exec, step.Target, step.Create, step.edit)
+}
@@ -0,0 +1,214 @@
+package step_test
+
+import (
+	"io/ioutil"
+	"os"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	"github.com/jayclassless/dotter/step"
+)
+
+var _ = Describe("LineInFileStep", func() {
+	Describe("NewLineInFileStep", func() {
+		It("Works", func() {
+			Expect(step.NewLineInFileStep()).ShouldNot(BeNil())
+		})
+	})
+
+	Describe("GetActivityLabel", func() {
+		It("Works", func() {
+			Expect(step.NewLineInFileStep().GetActivityLabel()).To(Equal("Editing"))
+		})
+	})
+
+	Describe("GetActivityDetails", func() {
+		It("Works", func() {
+			step := step.NewLineInFileStep()
+			step.Target = "foobar"
+
+			Expect(step.GetActivityDetails()).To(Equal("foobar"))
+		})
+	})
+
+	Describe("Execute", func() {
+		var executor *TestExecutor
+
+		BeforeEach(func() {
+			executor = NewTestExecutor(tmpdir(), tmpdir())
+			writeFile(executor.target, ".profile", "export EDITOR=nano\nexport PATH=$HOME/bin:$PATH\n")
+		})
+
+		AfterEach(func() {
+			rmdir(executor.target)
+			rmdir(executor.source)
+		})
+
+		readTarget := func(path string) string {
+			content, err := ioutil.ReadFile(executor.GetTargetPath(path))
+			Expect(err).Should(Succeed())
+			return string(content)
+		}
+
+		It("Adds missing lines to the end", func() {
+			s := step.NewLineInFileStep()
+			s.Target = ".profile"
+			s.Line = "export PAGER=less"
+
+			changes, err := s.Plan(executor)
+			Expect(err).Should(Succeed())
+			Expect(changes).To(HaveLen(1))
+			Expect(changes[0].Type).To(Equal(step.ChangeUpdate))
+
+			Expect(s.Execute(executor)).To(haveStatus("updated"))
+			Expect(readTarget(".profile")).To(Equal("export EDITOR=nano\nexport PATH=$HOME/bin:$PATH\nexport PAGER=less\n"))
+			Expect(executor.backedUp).To(Equal([]string{executor.GetTargetPath(".profile")}))
+			Expect(executor.tracked).To(HaveLen(0))
+
+			Expect(s.Execute(executor)).To(haveStatus("unchanged"))
+			Expect(executor.backedUp).To(HaveLen(1))
+		})
+
+		It("Replaces the line matching the regexp", func() {
+			s := step.NewLineInFileStep()
+			s.Target = ".profile"
+			s.Line = "export EDITOR=vim"
+			s.Regexp = "^export EDITOR="
+
+			Expect(s.Execute(executor)).To(haveStatus("updated"))
+			Expect(readTarget(".profile")).To(Equal("export EDITOR=vim\nexport PATH=$HOME/bin:$PATH\n"))
+			Expect(s.Execute(executor)).To(haveStatus("unchanged"))
+		})
+
+		It("Inserts before and after anchors", func() {
+			s := step.NewLineInFileStep()
+			s.Target = ".profile"
+			s.Line = "# managed"
+			s.InsertBefore = "BOF"
+			Expect(s.Execute(executor)).To(haveStatus("updated"))
+
+			s.Line = "export VISUAL=$EDITOR"
+			s.InsertBefore = ""
+			s.InsertAfter = "^export EDITOR="
+			Expect(s.Execute(executor)).To(haveStatus("updated"))
+
+			s.Line = "export GOPATH=$HOME/go"
+			s.InsertAfter = ""
+			s.InsertBefore = "PATH="
+			Expect(s.Execute(executor)).To(haveStatus("updated"))
+
+			Expect(readTarget(".profile")).To(Equal(
+				"# managed\nexport EDITOR=nano\nexport VISUAL=$EDITOR\nexport GOPATH=$HOME/go\nexport PATH=$HOME/bin:$PATH\n",
+			))
+		})
+
+		It("Removes lines when absent", func() {
+			s := step.NewLineInFileStep()
+			s.Target = ".profile"
+			s.Regexp = "^export"
+			s.State = "absent"
+
+			result, err := s.Execute(executor)
+			Expect(err).Should(Succeed())
+			Expect(result.Message).To(Equal("removed 2 line(s)"))
+			Expect(readTarget(".profile")).To(Equal(""))
+			Expect(s.Execute(executor)).To(haveStatus("unchanged"))
+		})
+
+		It("Creates missing files when configured", func() {
+			s := step.NewLineInFileStep()
+			s.Target = ".ssh/config"
+			s.Line = "Include config.d/*"
+
+			changes, err := s.Plan(executor)
+			Expect(err).Should(Succeed())
+			Expect(changes).To(HaveLen(2))
+			Expect(s.Execute(executor)).To(haveStatus("created"))
+			Expect(readTarget(".ssh/config")).To(Equal("Include config.d/*\n"))
+
+			s.Target = ".bashrc"
+			s.Create = false
+			_, err = s.Execute(executor)
+			Expect(err).To(MatchError(ContainSubstring("does not exist")))
+		})
+
+		It("Leaves missing files alone when absent", func() {
+			s := step.NewLineInFileStep()
+			s.Target = ".bashrc"
+			s.Line = "set -o vi"
+			s.State = "absent"
+
+			Expect(s.Execute(executor)).To(haveStatus("unchanged"))
+			_, err := os.Stat(executor.GetTargetPath(".bashrc"))
+			Expect(os.IsNotExist(err)).To(BeTrue())
+		})
+
+		It("Keeps the mode of the file", func() {
+			os.Chmod(executor.GetTargetPath(".profile"), 0o600)
+			s := step.NewLineInFileStep()
+			s.Target = ".profile"
+			s.Line = "umask 022"
+			Expect(s.Execute(executor)).To(haveStatus("updated"))
+
+			fileInfo, err := os.Stat(executor.GetTargetPath(".profile"))
+			Expect(err).Should(Succeed())
+			Expect(fileInfo.Mode().Perm()).To(Equal(os.FileMode(0o600)))
+
+			children, err := ioutil.ReadDir(executor.target)
+			Expect(err).Should(Succeed())
+			Expect(children).To(HaveLen(1))
+		})
+
+		It("Leaves files without a final newline that way", func() {
+			writeFile(executor.target, ".profile", "export EDITOR=nano")
+			s := step.NewLineInFileStep()
+			s.Target = ".profile"
+			s.Line = "umask 022"
+
+			Expect(s.Execute(executor)).To(haveStatus("updated"))
+			Expect(readTarget(".profile")).To(Equal("export EDITOR=nano\numask 022"))
+		})
+
+		It("Edits the file a link points to", func() {
+			writeFile(executor.target, ".profile.local", "export EDITOR=nano\n")
+			rm(executor.target, ".profile")
+			Expect(os.Symlink(executor.GetTargetPath(".profile.local"), executor.GetTargetPath(".profile"))).Should(Succeed())
+			s := step.NewLineInFileStep()
+			s.Target = ".profile"
+			s.Line = "umask 022"
+
+			Expect(s.Execute(executor)).To(haveStatus("updated"))
+			Expect(readTarget(".profile.local")).To(Equal("export EDITOR=nano\numask 022\n"))
+			fileInfo, err := os.Lstat(executor.GetTargetPath(".profile"))
+			Expect(err).Should(Succeed())
+			Expect(fileInfo.Mode() & os.ModeSymlink).ToNot(BeZero())
+		})
+
+		It("Refuses to edit files in the source directory through links", func() {
+			writeFile(executor.source, "profile", "export EDITOR=nano\n")
+			rm(executor.target, ".profile")
+			Expect(os.Symlink(executor.GetSourcePath("profile"), executor.GetTargetPath(".profile"))).Should(Succeed())
+			s := step.NewLineInFileStep()
+			s.Target = ".profile"
+			s.Line = "umask 022"
+
+			_, err := s.Execute(executor)
+			Expect(err).To(MatchError(ContainSubstring("in the source directory")))
+			content, err := ioutil.ReadFile(executor.GetSourcePath("profile"))
+			Expect(err).Should(Succeed())
+			Expect(string(content)).To(Equal("export EDITOR=nano\n"))
+			Expect(executor.backedUp).To(HaveLen(0))
+		})
+
+		It("Fails on unknown states", func() {
+			s := step.NewLineInFileStep()
+			s.Target = ".profile"
+			s.Line = "umask 022"
+			s.State = "gone"
+
+			_, err := s.Execute(executor)
+			Expect(err).To(MatchError(ContainSubstring("Unknown state \"gone\"")))
+		})
+	})
+})
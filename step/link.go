@@ -27,6 +27,7 @@ func NewLinkOptions() LinkOptions {
 // LinkStep contains the specification for Link steps
 type LinkStep struct {
 	LinkOptions `yaml:",inline"`
+	StepMeta    `yaml:",inline"`
 	Target      string
 	Source      string
 }
@@ -53,81 +54,214 @@ func (step LinkStep) GetActivityDetails() string {
 	return step.Target
 }
 
-// Execute creates the specified symlink
-func (step LinkStep) Execute(exec StepExecutor) error {
+type linkState int
+
+const (
+	linkMissing linkState = iota
+	linkMissingParent
+	linkCorrect
+	linkWrong
+	linkBlocked
+)
+
+type linkInspection struct {
+	state      linkState
+	targetPath string
+	sourcePath string
+	parentPath string
+	current    string
+}
+
+func (step LinkStep) inspect(exec StepExecutor) (linkInspection, error) {
 	var err error
+	result := linkInspection{}
 
-	targetPath := exec.GetTargetPath(step.Target)
-	sourcePath := exec.GetSourcePath(step.Source)
+	result.targetPath = exec.GetTargetPath(step.Target)
+	result.sourcePath = exec.GetSourcePath(step.Source)
 	if step.Relative {
-		sourcePath, err = filepath.Rel(filepath.Dir(targetPath), sourcePath)
+		result.sourcePath, err = filepath.Rel(filepath.Dir(result.targetPath), result.sourcePath)
 		if err != nil {
-			return err
+			return result, err
 		}
 	}
-	parentPath := filepath.Dir(targetPath)
+	result.parentPath = filepath.Dir(result.targetPath)
 
-	fileInfo, err := os.Lstat(targetPath)
+	fileInfo, err := os.Lstat(result.targetPath)
 	if err == nil {
 		if IsSymLink(fileInfo) {
-			current, err := os.Readlink(targetPath)
+			result.current, err = os.Readlink(result.targetPath)
 			if err != nil {
-				return nil
+				return result, err
 			}
-			if current == sourcePath {
-				// Link exists and is pointing to the right thing
-				return nil
-
-			} else if step.Relink {
-				// Link exists, but is wrong, and we want to fix it
-				err = os.Remove(targetPath)
-				if err != nil {
-					return err
-				}
-				return os.Symlink(sourcePath, targetPath)
-
+			if result.current == result.sourcePath {
+				result.state = linkCorrect
+			} else {
+				result.state = linkWrong
 			}
-
-			// Link exists, but is wrong
-			return fmt.Errorf(
-				"Cannot create %s as a symlink because one already exists",
-				targetPath,
-			)
+		} else {
+			result.state = linkBlocked
 		}
 
-		if step.Force {
-			// Something other than a link exists, and we want to replace it
-			err = exec.ForceRemove(targetPath)
-			if err != nil {
-				return err
-			}
-			return os.Symlink(sourcePath, targetPath)
+	} else if os.IsNotExist(err) {
+		_, err := os.Stat(result.parentPath)
+		if os.IsNotExist(err) {
+			result.state = linkMissingParent
+		} else if err != nil {
+			return result, err
+		} else {
+			result.state = linkMissing
 		}
 
+	} else {
+		return result, err
+	}
+
+	return result, nil
+}
+
+func (step LinkStep) check(inspection linkInspection) error {
+	if inspection.state == linkWrong && !step.Relink {
+		// Link exists, but is wrong
+		return fmt.Errorf(
+			"Cannot create %s as a symlink because one already exists",
+			inspection.targetPath,
+		)
+
+	} else if inspection.state == linkBlocked && !step.Force {
 		// Something other than a link exists
-		return fmt.Errorf("Non-link %s already exists", targetPath)
+		return fmt.Errorf("Non-link %s already exists", inspection.targetPath)
 
-	} else if os.IsNotExist(err) {
-		// Nothing exists, make the link
-		_, err := os.Stat(parentPath)
-		if os.IsNotExist(err) {
-			if step.CreateParents {
-				// Parent dir doesn't exist, make it first
-				os.MkdirAll(parentPath, os.FileMode(0o777))
-			} else {
-				// Parent dir doesn't exist
-				return fmt.Errorf(
-					"Cannot create %s as parent directory %s does not exist",
-					step.Target,
-					parentPath,
-				)
-			}
-		} else if err != nil {
-			return err
+	} else if inspection.state == linkMissingParent && !step.CreateParents {
+		// Parent dir doesn't exist
+		return fmt.Errorf(
+			"Cannot create %s as parent directory %s does not exist",
+			step.Target,
+			inspection.parentPath,
+		)
+	}
+
+	return nil
+}
+
+// Plan describes the changes that Execute would make to create the specified symlink
+func (step LinkStep) Plan(exec StepExecutor) ([]Change, error) {
+	inspection, err := step.inspect(exec)
+	if err != nil {
+		return nil, err
+	}
+	err = step.check(inspection)
+	if err != nil {
+		return nil, err
+	}
+
+	changes := make([]Change, 0)
+
+	switch inspection.state {
+	case linkMissingParent:
+		changes = append(changes, NewChange(ChangeCreate, "mkdir %s", inspection.parentPath))
+		changes = append(changes, NewChange(ChangeCreate, "link %s -> %s", inspection.targetPath, inspection.sourcePath))
+	case linkMissing:
+		changes = append(changes, NewChange(ChangeCreate, "link %s -> %s", inspection.targetPath, inspection.sourcePath))
+	case linkWrong:
+		changes = append(changes, NewChange(
+			ChangeUpdate,
+			"relink %s -> %s (was %s)",
+			inspection.targetPath,
+			inspection.sourcePath,
+			inspection.current,
+		))
+	case linkBlocked:
+		changes = append(changes, NewChange(ChangeReplace, "replace %s with link -> %s", inspection.targetPath, inspection.sourcePath))
+	}
+
+	return changes, nil
+}
+
+// Execute creates the specified symlink
+func (step LinkStep) Execute(exec StepExecutor) (Result, error) {
+	inspection, err := step.inspect(exec)
+	if err != nil {
+		return Result{}, err
+	}
+	err = step.check(inspection)
+	if err != nil {
+		return Result{}, err
+	}
+
+	result := NewResult(ResultCreated, "linked to %s", inspection.sourcePath)
+
+	switch inspection.state {
+	case linkCorrect:
+		// Link exists and is pointing to the right thing
+		return NewResult(ResultUnchanged, "already linked to %s", inspection.sourcePath), nil
+
+	case linkWrong:
+		// Link exists, but is wrong, and we want to fix it
+		err = os.Remove(inspection.targetPath)
+		if err != nil {
+			return Result{}, err
+		}
+		result = NewResult(ResultUpdated, "relinked to %s (was %s)", inspection.sourcePath, inspection.current)
+
+	case linkBlocked:
+		// Something other than a link exists, and we want to replace it
+		err = exec.ForceRemove(inspection.targetPath)
+		if err != nil {
+			return Result{}, err
 		}
+		result = NewResult(ResultReplaced, "replaced with link to %s", inspection.sourcePath)
+
+	case linkMissingParent:
+		// Parent dir doesn't exist, make it first
+		err = os.MkdirAll(inspection.parentPath, os.FileMode(0o777))
+		if err != nil {
+			return Result{}, err
+		}
+	}
+
+	err = os.Symlink(inspection.sourcePath, inspection.targetPath)
+	if err != nil {
+		return Result{}, err
+	}
+	exec.Track(TrackedLink, inspection.targetPath, inspection.sourcePath)
+
+	return result, nil
+}
+
+// Uninstall removes the symlink if it still points at the source, and then
+// restores whatever it replaced
+func (step LinkStep) Uninstall(exec StepExecutor) error {
+	targetPath := exec.GetTargetPath(step.Target)
+
+	fileInfo, err := os.Lstat(targetPath)
+	if os.IsNotExist(err) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+	if !IsSymLink(fileInfo) {
+		return nil
+	}
+
+	current, err := os.Readlink(targetPath)
+	if err != nil {
+		return err
+	}
+	if !filepath.IsAbs(current) {
+		current = filepath.Join(filepath.Dir(targetPath), current)
+	}
+	if filepath.Clean(current) != exec.GetSourcePath(step.Source) {
+		exec.PrintInfo(fmt.Sprintf("Leaving %s as it does not point to %s", targetPath, step.Source))
+		return nil
+	}
 
-		return os.Symlink(sourcePath, targetPath)
+	err = os.Remove(targetPath)
+	if err != nil {
+		return err
 	}
+	exec.Untrack(targetPath)
+	exec.PrintInfo(fmt.Sprintf("Removed %s", targetPath))
 
+	_, err = exec.RestoreBackup(targetPath)
 	return err
 }
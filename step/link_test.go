@@ -32,6 +32,91 @@ var _ = Describe("LinkStep", func() {
 		})
 	})
 
+	Describe("Plan", func() {
+		var executor *TestExecutor
+
+		BeforeEach(func() {
+			executor = NewTestExecutor(tmpdir(), tmpdir())
+		})
+
+		AfterEach(func() {
+			rmdir(executor.target)
+			rmdir(executor.source)
+		})
+
+		It("Plans new links", func() {
+			s := step.NewLinkStep()
+			s.Target = "some/foo"
+			s.Source = "bar"
+			s.Relative = false
+
+			changes, err := s.Plan(executor)
+			Expect(err).Should(Succeed())
+			Expect(changes).To(HaveLen(2))
+			Expect(changes[0].Type).To(Equal(step.ChangeCreate))
+			Expect(changes[0].Description).To(Equal("mkdir " + executor.GetTargetPath("some")))
+			Expect(changes[1].Type).To(Equal(step.ChangeCreate))
+			Expect(changes[1].Description).To(Equal(
+				"link " + executor.GetTargetPath("some/foo") + " -> " + executor.GetSourcePath("bar"),
+			))
+
+			_, err = os.Lstat(executor.GetTargetPath("some"))
+			Expect(os.IsNotExist(err)).To(BeTrue())
+		})
+
+		It("Plans nothing for existing links", func() {
+			s := step.NewLinkStep()
+			s.Target = "foo"
+			s.Source = "bar"
+			s.Relative = false
+			ln(executor.GetTargetPath("foo"), executor.GetSourcePath("bar"))
+
+			changes, err := s.Plan(executor)
+			Expect(err).Should(Succeed())
+			Expect(changes).To(HaveLen(0))
+		})
+
+		It("Plans relinks", func() {
+			s := step.NewLinkStep()
+			s.Target = "foo"
+			s.Source = "bar"
+			ln(executor.GetTargetPath("foo"), "bogus")
+
+			changes, err := s.Plan(executor)
+			Expect(err).Should(Succeed())
+			Expect(changes).To(HaveLen(1))
+			Expect(changes[0].Type).To(Equal(step.ChangeUpdate))
+
+			linkPath, err := os.Readlink(executor.GetTargetPath("foo"))
+			Expect(err).Should(Succeed())
+			Expect(linkPath).To(Equal("bogus"))
+		})
+
+		It("Plans replacements when Force is enabled", func() {
+			s := step.NewLinkStep()
+			s.Target = "foo"
+			s.Source = "bar"
+			s.Force = true
+			writeFile(executor.target, "foo", "foo")
+
+			changes, err := s.Plan(executor)
+			Expect(err).Should(Succeed())
+			Expect(changes).To(HaveLen(1))
+			Expect(changes[0].Type).To(Equal(step.ChangeReplace))
+			Expect(executor.backedUp).To(HaveLen(0))
+		})
+
+		It("Fails on collisions when Force is disabled", func() {
+			s := step.NewLinkStep()
+			s.Target = "foo"
+			s.Source = "bar"
+			writeFile(executor.target, "foo", "foo")
+
+			_, err := s.Plan(executor)
+			Expect(err).Should(HaveOccurred())
+		})
+	})
+
 	Describe("Execute", func() {
 		var executor *TestExecutor
 
@@ -49,8 +134,10 @@ var _ = Describe("LinkStep", func() {
 			s.Target = "foo"
 			s.Source = "bar"
 
-			err := s.Execute(executor)
+			result, err := s.Execute(executor)
 			Expect(err).Should(Succeed())
+			Expect(result).To(haveStatus("created"))
+			Expect(executor.tracked).To(HaveKeyWithValue(executor.GetTargetPath("foo"), step.TrackedLink))
 
 			fileInfo, err := os.Lstat(executor.GetTargetPath("foo"))
 			Expect(err).Should(Succeed())
@@ -68,7 +155,7 @@ var _ = Describe("LinkStep", func() {
 			s.Source = "bar"
 			s.Relative = false
 
-			err := s.Execute(executor)
+			_, err := s.Execute(executor)
 			Expect(err).Should(Succeed())
 
 			fileInfo, err := os.Lstat(executor.GetTargetPath("foo"))
@@ -86,7 +173,7 @@ var _ = Describe("LinkStep", func() {
 			s.Source = "bar"
 			s.Relative = false
 
-			err := s.Execute(executor)
+			_, err := s.Execute(executor)
 			Expect(err).Should(Succeed())
 
 			fileInfo, err := os.Lstat(executor.GetTargetPath("some/deep/foo"))
@@ -104,7 +191,7 @@ var _ = Describe("LinkStep", func() {
 			s.Source = "bar"
 			s.CreateParents = false
 
-			err := s.Execute(executor)
+			_, err := s.Execute(executor)
 			Expect(err).Should(HaveOccurred())
 
 			_, err = os.Lstat(executor.GetTargetPath("some/deep/foo"))
@@ -119,8 +206,9 @@ var _ = Describe("LinkStep", func() {
 
 			ln(executor.GetTargetPath("foo"), executor.GetSourcePath("bar"))
 
-			err := s.Execute(executor)
+			result, err := s.Execute(executor)
 			Expect(err).Should(Succeed())
+			Expect(result).To(haveStatus("unchanged"))
 
 			fileInfo, err := os.Lstat(executor.GetTargetPath("foo"))
 			Expect(err).Should(Succeed())
@@ -139,8 +227,9 @@ var _ = Describe("LinkStep", func() {
 
 			ln(executor.GetTargetPath("foo"), "bogus")
 
-			err := s.Execute(executor)
+			result, err := s.Execute(executor)
 			Expect(err).Should(Succeed())
+			Expect(result).To(haveStatus("updated"))
 
 			fileInfo, err := os.Lstat(executor.GetTargetPath("foo"))
 			Expect(err).Should(Succeed())
@@ -159,7 +248,7 @@ var _ = Describe("LinkStep", func() {
 
 			ln(executor.GetTargetPath("foo"), "bogus")
 
-			err := s.Execute(executor)
+			_, err := s.Execute(executor)
 			Expect(err).Should(HaveOccurred())
 
 			fileInfo, err := os.Lstat(executor.GetTargetPath("foo"))
@@ -180,8 +269,9 @@ var _ = Describe("LinkStep", func() {
 
 			writeFile(executor.target, "foo", "foo")
 
-			err := s.Execute(executor)
+			result, err := s.Execute(executor)
 			Expect(err).Should(Succeed())
+			Expect(result).To(haveStatus("replaced"))
 			Expect(executor.backedUp).To(HaveLen(1))
 
 			fileInfo, err := os.Lstat(executor.GetTargetPath("foo"))
@@ -202,7 +292,7 @@ var _ = Describe("LinkStep", func() {
 
 			writeFile(executor.target, "foo", "foo")
 
-			err := s.Execute(executor)
+			_, err := s.Execute(executor)
 			Expect(err).Should(HaveOccurred())
 			Expect(executor.backedUp).To(HaveLen(0))
 
@@ -211,4 +301,67 @@ var _ = Describe("LinkStep", func() {
 			Expect(fileInfo.Mode().IsRegular()).To(BeTrue())
 		})
 	})
+
+	Describe("Uninstall", func() {
+		var executor *TestExecutor
+
+		BeforeEach(func() {
+			executor = NewTestExecutor(tmpdir(), tmpdir())
+		})
+
+		AfterEach(func() {
+			rmdir(executor.target)
+			rmdir(executor.source)
+		})
+
+		It("Removes links to the source", func() {
+			s := step.NewLinkStep()
+			s.Target = "foo"
+			s.Source = "bar"
+			Expect(s.Execute(executor)).To(haveStatus("created"))
+
+			err := s.Uninstall(executor)
+			Expect(err).Should(Succeed())
+
+			_, err = os.Lstat(executor.GetTargetPath("foo"))
+			Expect(os.IsNotExist(err)).To(BeTrue())
+			Expect(executor.restored).To(Equal([]string{executor.GetTargetPath("foo")}))
+			Expect(executor.tracked).To(HaveLen(0))
+		})
+
+		It("Leaves links to other places", func() {
+			s := step.NewLinkStep()
+			s.Target = "foo"
+			s.Source = "bar"
+			ln(executor.GetTargetPath("foo"), "bogus")
+
+			err := s.Uninstall(executor)
+			Expect(err).Should(Succeed())
+
+			_, err = os.Lstat(executor.GetTargetPath("foo"))
+			Expect(err).Should(Succeed())
+			Expect(executor.restored).To(HaveLen(0))
+		})
+
+		It("Leaves non-links", func() {
+			s := step.NewLinkStep()
+			s.Target = "foo"
+			s.Source = "bar"
+			writeFile(executor.target, "foo", "foo")
+
+			err := s.Uninstall(executor)
+			Expect(err).Should(Succeed())
+
+			_, err = os.Lstat(executor.GetTargetPath("foo"))
+			Expect(err).Should(Succeed())
+		})
+
+		It("Handles missing links", func() {
+			s := step.NewLinkStep()
+			s.Target = "foo"
+			s.Source = "bar"
+
+			Expect(s.Uninstall(executor)).Should(Succeed())
+		})
+	})
 })
@@ -0,0 +1,22 @@
+//go:build !windows
+// +build !windows
+
+package step
+
+import (
+	osexec "os/exec"
+	"syscall"
+)
+
+// startProcessGroup makes the command the leader of a new process group, so
+// that it can be killed along with anything it starts
+func startProcessGroup(cmd *osexec.Cmd) {
+	cmd.SysProcAttr = &syscall.SysProcAttr{Setpgid: true}
+}
+
+// killProcessGroup kills the command and anything it started
+func killProcessGroup(cmd *osexec.Cmd) {
+	if cmd.Process != nil {
+		_ = syscall.Kill(-cmd.Process.Pid, syscall.SIGKILL)
+	}
+}
@@ -0,0 +1,19 @@
+//go:build windows
+// +build windows
+
+package step
+
+import (
+	osexec "os/exec"
+)
+
+// startProcessGroup does nothing, as Windows has no process groups to set up
+func startProcessGroup(cmd *osexec.Cmd) {
+}
+
+// killProcessGroup kills the command; anything it started is left running
+func killProcessGroup(cmd *osexec.Cmd) {
+	if cmd.Process != nil {
+		_ = cmd.Process.Kill()
+	}
+}
@@ -2,27 +2,56 @@ package step
 
 import (
 	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
 	"os"
 	osexec "os/exec"
+	"path/filepath"
+	"strings"
+	"time"
 )
 
 // ShellOptions contains non-command options for Shell steps
 type ShellOptions struct {
-	Quiet bool
+	Quiet        bool
+	Stream       bool
+	Interactive  bool
+	Shell        string
+	Env          map[string]string
+	Cwd          string
+	CwdFrom      string `yaml:"cwd_from"`
+	Timeout      time.Duration
+	SuccessCodes []int `yaml:"success_codes"`
 }
 
 // NewShellOptions creates a new instance of a ShellOptions struct
 func NewShellOptions() ShellOptions {
 	opt := ShellOptions{}
 	opt.Quiet = true
+	opt.Stream = false
+	opt.Interactive = false
+	opt.Shell = ""
+	opt.Env = make(map[string]string)
+	opt.Cwd = ""
+	opt.CwdFrom = "target"
+	opt.Timeout = 0
+	opt.SuccessCodes = []int{0}
 	return opt
 }
 
 // ShellStep contains the specification for Shell steps
 type ShellStep struct {
 	ShellOptions `yaml:",inline"`
+	StepMeta     `yaml:",inline"`
 	Command      string
 	Description  string
+	Creates      string
+	Unless       string
+	Run          string
+	Files        StringList
 }
 
 // NewShellStep creates a new instance of a ShellStep struct using default options
@@ -34,6 +63,13 @@ func NewShellStep() ShellStep {
 func NewShellStepWithDefaults(defaults ShellOptions) ShellStep {
 	step := ShellStep{}
 	step.ShellOptions = defaults
+
+	// Copy the environment so that steps don't add to each other's
+	step.Env = make(map[string]string, len(defaults.Env))
+	for name, value := range defaults.Env {
+		step.Env[name] = value
+	}
+
 	return step
 }
 
@@ -50,38 +86,309 @@ func (step ShellStep) GetActivityDetails() string {
 	return step.Command
 }
 
-// Execute runs the specified command in a shell
-func (step ShellStep) Execute(exec StepExecutor) error {
-	cmd := osexec.Command(
-		step.getShell(),
-		"-c",
-		step.Command,
+// Plan describes the command that Execute would run
+func (step ShellStep) Plan(exec StepExecutor) ([]Change, error) {
+	satisfied, _, err := step.checkGuards(exec)
+	if err != nil || satisfied {
+		return []Change{}, err
+	}
+
+	return []Change{NewChange(ChangeRun, "run %s", step.Command)}, nil
+}
+
+// checkGuards determines whether or not the command can be skipped because
+// what it creates already exists or its unless command succeeds, returning
+// the reason if so
+func (step ShellStep) checkGuards(exec StepExecutor) (bool, string, error) {
+	satisfied, reason, err := step.checkRunMode(exec)
+	if err != nil || satisfied {
+		return satisfied, reason, err
+	}
+
+	if step.Creates != "" {
+		path := step.Creates
+		if !filepath.IsAbs(path) {
+			path = exec.GetTargetPath(path)
+		}
+		if _, err := os.Lstat(path); err == nil {
+			return true, fmt.Sprintf("%s exists", path), nil
+		}
+	}
+
+	if step.Unless != "" {
+		dir, err := step.getWorkingDirectory(exec)
+		if err != nil {
+			return false, "", err
+		}
+		args := step.getCommand(step.Unless)
+		cmd := osexec.Command(args[0], args[1:]...)
+		cmd.Dir = dir
+		cmd.Env = step.getEnvironment()
+		if cmd.Run() == nil {
+			return true, fmt.Sprintf("\"%s\" succeeded", step.Unless), nil
+		}
+	}
+
+	return false, "", nil
+}
+
+// getRunKey returns the identity under which the command's runs are tracked
+func (step ShellStep) getRunKey() string {
+	identity := step.Name
+	if identity == "" {
+		identity = step.Description
+	}
+	if identity == "" {
+		identity = step.Command
+	}
+	return "shell:" + identity
+}
+
+// getRunChecksum returns a digest of the command and the contents of the
+// source files it depends on
+func (step ShellStep) getRunChecksum(exec StepExecutor) (string, error) {
+	hash := sha256.New()
+	io.WriteString(hash, step.Command)
+
+	for _, file := range step.Files {
+		sum, err := Checksum(exec.GetSourcePath(file))
+		if os.IsNotExist(err) {
+			sum = "missing"
+		} else if err != nil {
+			return "", err
+		}
+		fmt.Fprintf(hash, "\x00%s\x00%s", file, sum)
+	}
+
+	return hex.EncodeToString(hash.Sum(nil)), nil
+}
+
+// checkRunMode determines whether or not the command can be skipped because
+// it only runs once or when it has changed, returning the reason if so
+func (step ShellStep) checkRunMode(exec StepExecutor) (bool, string, error) {
+	switch step.Run {
+	case "", "always":
+		return false, "", nil
+
+	case "once":
+		if _, ok := exec.FindTracked(TrackedRun, step.getRunKey()); ok {
+			return true, "already run once", nil
+		}
+		return false, "", nil
+
+	case "onchange":
+		sum, err := step.getRunChecksum(exec)
+		if err != nil {
+			return false, "", err
+		}
+		if previous, ok := exec.FindTracked(TrackedRun, step.getRunKey()); ok && previous == sum {
+			return true, "unchanged since the last run", nil
+		}
+		return false, "", nil
+	}
+
+	return false, "", fmt.Errorf(
+		"Unknown run mode \"%s\", expected \"always\", \"once\" or \"onchange\"",
+		step.Run,
 	)
+}
+
+// getWorkingDirectory returns the directory the command is run in
+func (step ShellStep) getWorkingDirectory(exec StepExecutor) (string, error) {
+	if filepath.IsAbs(step.Cwd) {
+		return step.Cwd, nil
+	}
+
+	switch step.CwdFrom {
+	case "", "target":
+		return exec.GetTargetPath(step.Cwd), nil
+	case "source":
+		return exec.GetSourcePath(step.Cwd), nil
+	}
+	return "", fmt.Errorf("Unknown cwd_from \"%s\", expected \"source\" or \"target\"", step.CwdFrom)
+}
+
+// getCommand returns the interpreter and arguments used to run a command
+func (step ShellStep) getCommand(command string) []string {
+	shell := strings.Fields(step.Shell)
+	if len(shell) == 0 {
+		shell = []string{getShell()}
+	}
+	return append(shell, "-c", command)
+}
+
+func (step ShellStep) getEnvironment() []string {
+	env := os.Environ()
+	for name, value := range step.Env {
+		env = append(env, name+"="+value)
+	}
+	return env
+}
+
+// checkExitCode returns an error unless the command ran and its exit status
+// is one of those that count as success, including when that status is 0
+func (step ShellStep) checkExitCode(cmd *osexec.Cmd, err error) error {
+	var exitErr *osexec.ExitError
+	if err != nil && !errors.As(err, &exitErr) {
+		return err
+	}
+
+	code := cmd.ProcessState.ExitCode()
+	for _, success := range step.SuccessCodes {
+		if code == success {
+			return nil
+		}
+	}
+	if err != nil {
+		return err
+	}
+	return fmt.Errorf("Exit status %d is not one of the success codes %v", code, step.SuccessCodes)
+}
+
+// Execute runs the specified command in a shell
+func (step ShellStep) Execute(exec StepExecutor) (Result, error) {
+	satisfied, reason, err := step.checkGuards(exec)
+	if err != nil {
+		return Result{}, err
+	}
+	if satisfied {
+		return NewResult(ResultUnchanged, "skipped, %s", reason), nil
+	}
+
+	// The checksum is taken before running in case the command changes its files
+	sum := ""
+	if step.Run == "onchange" {
+		sum, err = step.getRunChecksum(exec)
+		if err != nil {
+			return Result{}, err
+		}
+	}
+
+	dir, err := step.getWorkingDirectory(exec)
+	if err != nil {
+		return Result{}, err
+	}
+
+	args := step.getCommand(step.Command)
+	cmd := osexec.Command(args[0], args[1:]...)
+
+	cmd.Dir = dir
+	cmd.Env = step.getEnvironment()
+	finishOutput := step.attachOutput(cmd, exec)
+	if !step.Interactive {
+		// Interactive commands need to stay in the terminal's foreground
+		// process group to be able to read from it
+		startProcessGroup(cmd)
+	}
+
+	err = cmd.Start()
+	if err != nil {
+		return Result{}, err
+	}
+
+	var timer *time.Timer
+	if step.Timeout > 0 {
+		timer = time.AfterFunc(step.Timeout, func() {
+			if step.Interactive {
+				// Not in a group of its own, so only the command itself can go
+				_ = cmd.Process.Kill()
+			} else {
+				killProcessGroup(cmd)
+			}
+		})
+	}
+	err = cmd.Wait()
+	timedOut := timer != nil && !timer.Stop()
+	finishOutput()
+
+	if timedOut {
+		return Result{}, fmt.Errorf("Timed out after %s", step.Timeout)
+	}
+	err = step.checkExitCode(cmd, err)
+	if err != nil {
+		return Result{}, err
+	}
+
+	if step.Run == "once" || step.Run == "onchange" {
+		exec.Track(TrackedRun, step.getRunKey(), sum)
+	}
+	return NewResult(ResultUpdated, "ran %s", step.Command), nil
+}
+
+// attachOutput connects the command to the terminal when interactive, or to
+// the executor otherwise, either line-by-line or all at once when it's done;
+// the returned function prints whatever is left after the command exits
+func (step ShellStep) attachOutput(cmd *osexec.Cmd, exec StepExecutor) func() {
+	if step.Interactive {
+		cmd.Stdin = os.Stdin
+		cmd.Stdout = os.Stdout
+		cmd.Stderr = os.Stderr
+		return func() {}
+	}
+
+	printInfo := exec.PrintInfo
+	if step.Quiet {
+		printInfo = func(string) {}
+	}
 
-	cmd.Dir = exec.GetTargetPath("")
 	cmd.Stdin = nil
+	if step.Stream {
+		stdout := newLineWriter(printInfo)
+		stderr := newLineWriter(exec.PrintError)
+		cmd.Stdout = stdout
+		cmd.Stderr = stderr
+		return func() {
+			stdout.Flush()
+			stderr.Flush()
+		}
+	}
+
 	var stdout bytes.Buffer
 	cmd.Stdout = &stdout
 	var stderr bytes.Buffer
 	cmd.Stderr = &stderr
+	return func() {
+		if outs := stdout.String(); len(outs) > 0 {
+			printInfo(outs)
+		}
+		if errs := stderr.String(); len(errs) > 0 {
+			exec.PrintError(errs)
+		}
+	}
+}
 
-	err := cmd.Run()
+// lineWriter passes each line written to it to a function as soon as it is complete
+type lineWriter struct {
+	print   func(string)
+	pending []byte
+}
 
-	if !step.Quiet {
-		outs := stdout.String()
-		if len(outs) > 0 {
-			exec.PrintInfo(outs)
+func newLineWriter(print func(string)) *lineWriter {
+	return &lineWriter{print: print}
+}
+
+func (writer *lineWriter) Write(data []byte) (int, error) {
+	writer.pending = append(writer.pending, data...)
+	for {
+		idx := bytes.IndexByte(writer.pending, '\n')
+		if idx < 0 {
+			break
 		}
+		writer.print(string(writer.pending[:idx+1]))
+		writer.pending = writer.pending[idx+1:]
 	}
-	errs := stderr.String()
-	if len(errs) > 0 {
-		exec.PrintError(errs)
-	}
+	return len(data), nil
+}
 
-	return err
+// Flush passes along anything written since the last complete line
+func (writer *lineWriter) Flush() {
+	if len(writer.pending) > 0 {
+		writer.print(string(writer.pending))
+		writer.pending = nil
+	}
 }
 
-func (step ShellStep) getShell() string {
+func getShell() string {
 	shell := os.Getenv("SHELL")
 	if shell == "" {
 		shell = "/bin/sh"
@@ -1,6 +1,9 @@
 package step_test
 
 import (
+	"path/filepath"
+	"time"
+
 	. "github.com/onsi/ginkgo"
 	. "github.com/onsi/gomega"
 
@@ -37,6 +40,17 @@ var _ = Describe("ShellStep", func() {
 		})
 	})
 
+	Describe("Plan", func() {
+		It("Works", func() {
+			s := step.NewShellStep()
+			s.Command = "foobar"
+
+			changes, err := s.Plan(NewTestExecutor("", ""))
+			Expect(err).Should(Succeed())
+			Expect(changes).To(Equal([]step.Change{{Type: step.ChangeRun, Description: "run foobar"}}))
+		})
+	})
+
 	Describe("Execute", func() {
 		var executor *TestExecutor
 
@@ -53,8 +67,9 @@ var _ = Describe("ShellStep", func() {
 			step := step.NewShellStep()
 			step.Command = "true"
 
-			err := step.Execute(executor)
+			result, err := step.Execute(executor)
 			Expect(err).Should(Succeed())
+			Expect(result).To(haveStatus("updated"))
 			Expect(executor.infoLog).To(HaveLen(0))
 			Expect(executor.errorLog).To(HaveLen(0))
 		})
@@ -63,7 +78,7 @@ var _ = Describe("ShellStep", func() {
 			step := step.NewShellStep()
 			step.Command = "false"
 
-			err := step.Execute(executor)
+			_, err := step.Execute(executor)
 			Expect(err).Should(HaveOccurred())
 			Expect(executor.infoLog).To(HaveLen(0))
 			Expect(executor.errorLog).To(HaveLen(0))
@@ -73,7 +88,7 @@ var _ = Describe("ShellStep", func() {
 			step := step.NewShellStep()
 			step.Command = "echo \"foo\""
 
-			err := step.Execute(executor)
+			_, err := step.Execute(executor)
 			Expect(err).Should(Succeed())
 			Expect(executor.infoLog).To(HaveLen(0))
 			Expect(executor.errorLog).To(HaveLen(0))
@@ -84,7 +99,7 @@ var _ = Describe("ShellStep", func() {
 			step.Command = "echo \"foo\""
 			step.Quiet = false
 
-			err := step.Execute(executor)
+			_, err := step.Execute(executor)
 			Expect(err).Should(Succeed())
 			Expect(executor.infoLog).To(Equal([]string{"foo\n"}))
 			Expect(executor.errorLog).To(HaveLen(0))
@@ -95,10 +110,246 @@ var _ = Describe("ShellStep", func() {
 			step.Command = "echo \"foo\" && echo \"bar\" >&2"
 			step.Quiet = false
 
-			err := step.Execute(executor)
+			_, err := step.Execute(executor)
 			Expect(err).Should(Succeed())
 			Expect(executor.infoLog).To(Equal([]string{"foo\n"}))
 			Expect(executor.errorLog).To(Equal([]string{"bar\n"}))
 		})
+
+		It("Streams output line by line", func() {
+			step := step.NewShellStep()
+			step.Command = "echo one && echo two >&2 && echo three && printf four"
+			step.Quiet = false
+			step.Stream = true
+
+			_, err := step.Execute(executor)
+			Expect(err).Should(Succeed())
+			Expect(executor.infoLog).To(Equal([]string{"one\n", "three\n", "four"}))
+			Expect(executor.errorLog).To(Equal([]string{"two\n"}))
+		})
+
+		It("Streams only errors when quiet", func() {
+			step := step.NewShellStep()
+			step.Command = "echo one && echo two >&2"
+			step.Stream = true
+
+			_, err := step.Execute(executor)
+			Expect(err).Should(Succeed())
+			Expect(executor.infoLog).To(HaveLen(0))
+			Expect(executor.errorLog).To(Equal([]string{"two\n"}))
+		})
+
+		It("Leaves output to the terminal when interactive", func() {
+			step := step.NewShellStep()
+			step.Command = "true"
+			step.Quiet = false
+			step.Interactive = true
+
+			_, err := step.Execute(executor)
+			Expect(err).Should(Succeed())
+			Expect(executor.infoLog).To(HaveLen(0))
+			Expect(executor.errorLog).To(HaveLen(0))
+		})
+
+		It("Skips when what it creates exists", func() {
+			step := step.NewShellStep()
+			step.Command = "touch created && echo ran"
+			step.Creates = "created"
+			step.Quiet = false
+
+			result, err := step.Execute(executor)
+			Expect(err).Should(Succeed())
+			Expect(result).To(haveStatus("updated"))
+
+			result, err = step.Execute(executor)
+			Expect(err).Should(Succeed())
+			Expect(result).To(haveStatus("unchanged"))
+			Expect(executor.infoLog).To(Equal([]string{"ran\n"}))
+
+			changes, err := step.Plan(executor)
+			Expect(err).Should(Succeed())
+			Expect(changes).To(HaveLen(0))
+		})
+
+		It("Skips when the unless command succeeds", func() {
+			step := step.NewShellStep()
+			step.Command = "touch created"
+			step.Unless = "test -f created"
+
+			changes, err := step.Plan(executor)
+			Expect(err).Should(Succeed())
+			Expect(changes).To(HaveLen(1))
+
+			result, err := step.Execute(executor)
+			Expect(err).Should(Succeed())
+			Expect(result).To(haveStatus("updated"))
+
+			result, err = step.Execute(executor)
+			Expect(err).Should(Succeed())
+			Expect(result).To(haveStatus("unchanged"))
+		})
+
+		It("Runs only once when configured", func() {
+			step := step.NewShellStep()
+			step.Command = "true"
+			step.Run = "once"
+
+			result, err := step.Execute(executor)
+			Expect(err).Should(Succeed())
+			Expect(result).To(haveStatus("updated"))
+
+			result, err = step.Execute(executor)
+			Expect(err).Should(Succeed())
+			Expect(result).To(haveStatus("unchanged"))
+		})
+
+		It("Runs again when the command or its files change", func() {
+			writeFile(executor.source, "Brewfile", "brew 'git'")
+			step := step.NewShellStep()
+			step.Command = "true"
+			step.Run = "onchange"
+			step.Files = []string{"Brewfile"}
+
+			result, err := step.Execute(executor)
+			Expect(err).Should(Succeed())
+			Expect(result).To(haveStatus("updated"))
+
+			result, err = step.Execute(executor)
+			Expect(err).Should(Succeed())
+			Expect(result).To(haveStatus("unchanged"))
+
+			writeFile(executor.source, "Brewfile", "brew 'git'\nbrew 'jq'")
+			result, err = step.Execute(executor)
+			Expect(err).Should(Succeed())
+			Expect(result).To(haveStatus("updated"))
+
+			step.Command = "true && true"
+			changes, err := step.Plan(executor)
+			Expect(err).Should(Succeed())
+			Expect(changes).To(HaveLen(1))
+		})
+
+		It("Does not record failed runs", func() {
+			step := step.NewShellStep()
+			step.Command = "false"
+			step.Run = "once"
+
+			_, err := step.Execute(executor)
+			Expect(err).Should(HaveOccurred())
+			Expect(executor.tracked).To(HaveLen(0))
+		})
+
+		It("Fails on unknown run modes", func() {
+			step := step.NewShellStep()
+			step.Command = "true"
+			step.Run = "sometimes"
+
+			_, err := step.Execute(executor)
+			Expect(err).To(MatchError(ContainSubstring("Unknown run mode \"sometimes\"")))
+		})
+
+		It("Uses the specified interpreter", func() {
+			step := step.NewShellStep()
+			step.Command = "echo $0"
+			step.Shell = "/bin/sh"
+			step.Quiet = false
+
+			_, err := step.Execute(executor)
+			Expect(err).Should(Succeed())
+			Expect(executor.infoLog).To(Equal([]string{"/bin/sh\n"}))
+		})
+
+		It("Adds to the environment", func() {
+			step := step.NewShellStep()
+			step.Command = "echo $DOTTER_FOO"
+			step.Env["DOTTER_FOO"] = "bar"
+			step.Quiet = false
+
+			_, err := step.Execute(executor)
+			Expect(err).Should(Succeed())
+			Expect(executor.infoLog).To(Equal([]string{"bar\n"}))
+		})
+
+		It("Runs in the target directory by default", func() {
+			mkdir(executor.target, "sub")
+			step := step.NewShellStep()
+			step.Command = "pwd -P"
+			step.Cwd = "sub"
+			step.Quiet = false
+
+			_, err := step.Execute(executor)
+			Expect(err).Should(Succeed())
+			expected, _ := filepath.EvalSymlinks(executor.GetTargetPath("sub"))
+			Expect(executor.infoLog).To(Equal([]string{expected + "\n"}))
+		})
+
+		It("Runs in the source directory when configured", func() {
+			step := step.NewShellStep()
+			step.Command = "pwd -P"
+			step.CwdFrom = "source"
+			step.Quiet = false
+
+			_, err := step.Execute(executor)
+			Expect(err).Should(Succeed())
+			expected, _ := filepath.EvalSymlinks(executor.source)
+			Expect(executor.infoLog).To(Equal([]string{expected + "\n"}))
+		})
+
+		It("Fails on unknown working directory bases", func() {
+			step := step.NewShellStep()
+			step.Command = "true"
+			step.CwdFrom = "elsewhere"
+
+			_, err := step.Execute(executor)
+			Expect(err).To(MatchError(ContainSubstring("Unknown cwd_from \"elsewhere\"")))
+		})
+
+		It("Kills everything the command started when it times out", func() {
+			step := step.NewShellStep()
+			step.Command = "sleep 10 & sleep 10"
+			step.Timeout = 200 * time.Millisecond
+
+			started := time.Now()
+			_, err := step.Execute(executor)
+			Expect(err).To(MatchError("Timed out after 200ms"))
+			Expect(time.Since(started)).To(BeNumerically("<", 5*time.Second))
+		})
+
+		It("Kills interactive commands when they time out", func() {
+			step := step.NewShellStep()
+			step.Command = "exec sleep 10"
+			step.Interactive = true
+			step.Timeout = 200 * time.Millisecond
+
+			started := time.Now()
+			_, err := step.Execute(executor)
+			Expect(err).To(MatchError("Timed out after 200ms"))
+			Expect(time.Since(started)).To(BeNumerically("<", 5*time.Second))
+		})
+
+		It("Accepts the specified exit codes", func() {
+			step := step.NewShellStep()
+			step.Command = "exit 3"
+			step.SuccessCodes = []int{0, 3}
+
+			_, err := step.Execute(executor)
+			Expect(err).Should(Succeed())
+
+			step.Command = "exit 4"
+			_, err = step.Execute(executor)
+			Expect(err).Should(HaveOccurred())
+		})
+
+		It("Fails on exit code 0 when it isn't a success code", func() {
+			step := step.NewShellStep()
+			step.Command = "exit 0"
+			step.SuccessCodes = []int{3}
+
+			_, err := step.Execute(executor)
+			Expect(err).To(MatchError("Exit status 0 is not one of the success codes [3]"))
+
+			step.Command = "exit 3"
+			Expect(step.Execute(executor)).To(haveStatus("updated"))
+		})
 	})
 })
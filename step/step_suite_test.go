@@ -9,6 +9,9 @@ import (
 	"github.com/fatih/color"
 	. "github.com/onsi/ginkgo"
 	. "github.com/onsi/gomega"
+	"github.com/onsi/gomega/types"
+
+	"github.com/jayclassless/dotter/step"
 )
 
 func init() {
@@ -20,6 +23,12 @@ func TestStep(t *testing.T) {
 	RunSpecs(t, "Step Suite")
 }
 
+func haveStatus(status string) types.GomegaMatcher {
+	return WithTransform(func(result step.Result) string {
+		return result.Status.String()
+	}, Equal(status))
+}
+
 func mkdir(pathParts ...string) string {
 	path := filepath.Join(pathParts...)
 	os.MkdirAll(path, os.ModePerm)
@@ -51,6 +60,9 @@ type TestExecutor struct {
 	target   string
 	source   string
 	backedUp []string
+	restored []string
+	tracked  map[string]string
+	sources  map[string]string
 	infoLog  []string
 	errorLog []string
 }
@@ -60,6 +72,9 @@ func NewTestExecutor(source string, target string) *TestExecutor {
 		target:   target,
 		source:   source,
 		backedUp: make([]string, 0),
+		restored: make([]string, 0),
+		tracked:  make(map[string]string),
+		sources:  make(map[string]string),
 		infoLog:  make([]string, 0),
 		errorLog: make([]string, 0),
 	}
@@ -78,6 +93,33 @@ func (exec *TestExecutor) ForceRemove(path string) error {
 	return os.RemoveAll(path)
 }
 
+func (exec *TestExecutor) RestoreBackup(path string) (bool, error) {
+	exec.restored = append(exec.restored, path)
+	return false, nil
+}
+
+func (exec *TestExecutor) Track(trackedType string, path string, source string) {
+	exec.tracked[path] = trackedType
+	exec.sources[path] = source
+}
+
+func (exec *TestExecutor) Untrack(path string) {
+	delete(exec.tracked, path)
+	delete(exec.sources, path)
+}
+
+func (exec *TestExecutor) IsTracked(path string) bool {
+	_, ok := exec.tracked[path]
+	return ok
+}
+
+func (exec *TestExecutor) FindTracked(trackedType string, path string) (string, bool) {
+	if exec.tracked[path] != trackedType {
+		return "", false
+	}
+	return exec.sources[path], true
+}
+
 func (exec *TestExecutor) PrintInfo(message string) {
 	exec.infoLog = append(exec.infoLog, message)
 }
@@ -0,0 +1,132 @@
+package step
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"runtime"
+	"strings"
+	"text/template"
+)
+
+// TemplateOptions contains non-path options for Template steps
+type TemplateOptions struct {
+	CreateParents bool `yaml:"create_parents"`
+	Mode          uint
+	Force         bool
+}
+
+// NewTemplateOptions creates a new instance of a TemplateOptions struct
+func NewTemplateOptions() TemplateOptions {
+	opt := TemplateOptions{}
+	opt.CreateParents = true
+	opt.Mode = 0o644
+	opt.Force = false
+	return opt
+}
+
+// TemplateStep contains the specification for Template steps
+type TemplateStep struct {
+	TemplateOptions `yaml:",inline"`
+	StepMeta        `yaml:",inline"`
+	Target          string
+	Source          string
+	Variables       map[string]string
+}
+
+// TemplateData is what is made available to the templates rendered by Template steps
+type TemplateData struct {
+	Env      map[string]string
+	Hostname string
+	OS       string
+	Arch     string
+	Vars     map[string]string
+}
+
+// NewTemplateStep creates a new instance of a TemplateStep struct using default options
+func NewTemplateStep() TemplateStep {
+	return NewTemplateStepWithDefaults(NewTemplateOptions())
+}
+
+// NewTemplateStepWithDefaults creates a new instance of a TemplateStep struct using the specified options
+func NewTemplateStepWithDefaults(defaults TemplateOptions) TemplateStep {
+	step := TemplateStep{}
+	step.TemplateOptions = defaults
+	step.Variables = make(map[string]string)
+	return step
+}
+
+// GetActivityLabel returns a short description of what a TemplateStep does
+func (step TemplateStep) GetActivityLabel() string {
+	return "Rendering"
+}
+
+// GetActivityDetails returns description specific to this particular instance of the TemplateStep
+func (step TemplateStep) GetActivityDetails() string {
+	return step.Target
+}
+
+// GetTemplateData assembles the data made available to the template
+func (step TemplateStep) GetTemplateData() TemplateData {
+	data := TemplateData{}
+	data.OS = runtime.GOOS
+	data.Arch = runtime.GOARCH
+	data.Hostname, _ = os.Hostname()
+	data.Vars = step.Variables
+
+	data.Env = make(map[string]string)
+	for _, pair := range os.Environ() {
+		parts := strings.SplitN(pair, "=", 2)
+		data.Env[parts[0]] = parts[1]
+	}
+
+	return data
+}
+
+func (step TemplateStep) render(exec StepExecutor) ([]byte, error) {
+	sourcePath := exec.GetSourcePath(step.Source)
+
+	content, err := ioutil.ReadFile(sourcePath)
+	if err != nil {
+		return nil, err
+	}
+
+	tmpl, err := template.New(step.Source).Option("missingkey=error").Parse(string(content))
+	if err != nil {
+		return nil, err
+	}
+
+	var rendered bytes.Buffer
+	err = tmpl.Execute(&rendered, step.GetTemplateData())
+	if err != nil {
+		return nil, err
+	}
+
+	return rendered.Bytes(), nil
+}
+
+// Plan describes the changes that Execute would make to write the rendered template
+func (step TemplateStep) Plan(exec StepExecutor) ([]Change, error) {
+	rendered, err := step.render(exec)
+	if err != nil {
+		return nil, err
+	}
+
+	return planFile(exec, step.Target, rendered, os.FileMode(step.Mode), step.CreateParents, step.Force)
+}
+
+// Execute renders the template and writes it to the target
+func (step TemplateStep) Execute(exec StepExecutor) (Result, error) {
+	rendered, err := step.render(exec)
+	if err != nil {
+		return Result{}, err
+	}
+
+	return writeFile(exec, step.Target, rendered, os.FileMode(step.Mode), step.CreateParents, step.Force)
+}
+
+// Uninstall removes the rendered file if it was written by dotter, and then
+// restores whatever it replaced
+func (step TemplateStep) Uninstall(exec StepExecutor) error {
+	return removeFile(exec, step.Target)
+}
@@ -0,0 +1,277 @@
+package step_test
+
+import (
+	"io/ioutil"
+	"os"
+	"runtime"
+	"time"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	"github.com/jayclassless/dotter/step"
+)
+
+var _ = Describe("TemplateStep", func() {
+	Describe("NewTemplateStep", func() {
+		It("Works", func() {
+			Expect(step.NewTemplateStep()).ShouldNot(BeNil())
+		})
+	})
+
+	Describe("GetActivityLabel", func() {
+		It("Works", func() {
+			Expect(step.NewTemplateStep().GetActivityLabel()).To(Equal("Rendering"))
+		})
+	})
+
+	Describe("GetActivityDetails", func() {
+		It("Works", func() {
+			step := step.NewTemplateStep()
+			step.Target = "foobar"
+
+			Expect(step.GetActivityDetails()).To(Equal("foobar"))
+		})
+	})
+
+	Describe("GetTemplateData", func() {
+		It("Works", func() {
+			os.Setenv("DOTTER_TEST", "foo")
+			defer os.Unsetenv("DOTTER_TEST")
+			step := step.NewTemplateStep()
+			step.Variables["email"] = "me@example.com"
+
+			data := step.GetTemplateData()
+			Expect(data.OS).To(Equal(runtime.GOOS))
+			Expect(data.Arch).To(Equal(runtime.GOARCH))
+			Expect(data.Hostname).ToNot(Equal(""))
+			Expect(data.Env).To(HaveKeyWithValue("DOTTER_TEST", "foo"))
+			Expect(data.Vars).To(HaveKeyWithValue("email", "me@example.com"))
+		})
+	})
+
+	Describe("Plan", func() {
+		var executor *TestExecutor
+
+		BeforeEach(func() {
+			executor = NewTestExecutor(tmpdir(), tmpdir())
+			writeFile(executor.source, "gitconfig", "email = {{ .Vars.email }}\n")
+		})
+
+		AfterEach(func() {
+			rmdir(executor.target)
+			rmdir(executor.source)
+		})
+
+		It("Plans new files", func() {
+			s := step.NewTemplateStep()
+			s.Target = ".gitconfig"
+			s.Source = "gitconfig"
+			s.Variables["email"] = "me@example.com"
+
+			changes, err := s.Plan(executor)
+			Expect(err).Should(Succeed())
+			Expect(changes).To(HaveLen(1))
+			Expect(changes[0].Type).To(Equal(step.ChangeCreate))
+
+			_, err = os.Stat(executor.GetTargetPath(".gitconfig"))
+			Expect(os.IsNotExist(err)).To(BeTrue())
+		})
+
+		It("Plans nothing for unchanged files", func() {
+			s := step.NewTemplateStep()
+			s.Target = ".gitconfig"
+			s.Source = "gitconfig"
+			s.Variables["email"] = "me@example.com"
+			Expect(s.Execute(executor)).To(haveStatus("created"))
+
+			changes, err := s.Plan(executor)
+			Expect(err).Should(Succeed())
+			Expect(changes).To(HaveLen(0))
+		})
+
+		It("Plans rewrites for changed files", func() {
+			s := step.NewTemplateStep()
+			s.Target = ".gitconfig"
+			s.Source = "gitconfig"
+			s.Variables["email"] = "me@example.com"
+			Expect(s.Execute(executor)).To(haveStatus("created"))
+
+			s.Variables["email"] = "other@example.com"
+			changes, err := s.Plan(executor)
+			Expect(err).Should(Succeed())
+			Expect(changes).To(HaveLen(1))
+			Expect(changes[0].Type).To(Equal(step.ChangeUpdate))
+		})
+	})
+
+	Describe("Execute", func() {
+		var executor *TestExecutor
+
+		BeforeEach(func() {
+			executor = NewTestExecutor(tmpdir(), tmpdir())
+			writeFile(executor.source, "gitconfig", "email = {{ .Vars.email }}\nos = {{ .OS }}\n")
+		})
+
+		AfterEach(func() {
+			rmdir(executor.target)
+			rmdir(executor.source)
+		})
+
+		readTarget := func(path string) string {
+			content, err := ioutil.ReadFile(executor.GetTargetPath(path))
+			Expect(err).Should(Succeed())
+			return string(content)
+		}
+
+		It("Handles the simple case", func() {
+			s := step.NewTemplateStep()
+			s.Target = ".gitconfig"
+			s.Source = "gitconfig"
+			s.Variables["email"] = "me@example.com"
+
+			_, err := s.Execute(executor)
+			Expect(err).Should(Succeed())
+			Expect(readTarget(".gitconfig")).To(Equal("email = me@example.com\nos = " + runtime.GOOS + "\n"))
+			Expect(executor.tracked).To(HaveKeyWithValue(executor.GetTargetPath(".gitconfig"), step.TrackedFile))
+
+			fileInfo, err := os.Stat(executor.GetTargetPath(".gitconfig"))
+			Expect(err).Should(Succeed())
+			Expect(fileInfo.Mode().Perm()).To(Equal(os.FileMode(0o644)))
+		})
+
+		It("Handles specified mode and deep paths", func() {
+			s := step.NewTemplateStep()
+			s.Target = "some/deep/.gitconfig"
+			s.Source = "gitconfig"
+			s.Mode = 0o600
+			s.Variables["email"] = "me@example.com"
+
+			_, err := s.Execute(executor)
+			Expect(err).Should(Succeed())
+
+			fileInfo, err := os.Stat(executor.GetTargetPath("some/deep/.gitconfig"))
+			Expect(err).Should(Succeed())
+			Expect(fileInfo.Mode().Perm()).To(Equal(os.FileMode(0o600)))
+		})
+
+		It("Does not rewrite unchanged files", func() {
+			s := step.NewTemplateStep()
+			s.Target = ".gitconfig"
+			s.Source = "gitconfig"
+			s.Variables["email"] = "me@example.com"
+			Expect(s.Execute(executor)).To(haveStatus("created"))
+
+			before, err := os.Stat(executor.GetTargetPath(".gitconfig"))
+			Expect(err).Should(Succeed())
+			os.Chtimes(executor.GetTargetPath(".gitconfig"), before.ModTime().Add(-time.Hour), before.ModTime().Add(-time.Hour))
+			before, _ = os.Stat(executor.GetTargetPath(".gitconfig"))
+
+			Expect(s.Execute(executor)).To(haveStatus("unchanged"))
+			after, err := os.Stat(executor.GetTargetPath(".gitconfig"))
+			Expect(err).Should(Succeed())
+			Expect(after.ModTime()).To(Equal(before.ModTime()))
+		})
+
+		It("Rewrites changed files", func() {
+			s := step.NewTemplateStep()
+			s.Target = ".gitconfig"
+			s.Source = "gitconfig"
+			s.Variables["email"] = "me@example.com"
+			Expect(s.Execute(executor)).To(haveStatus("created"))
+
+			s.Variables["email"] = "other@example.com"
+			Expect(s.Execute(executor)).To(haveStatus("updated"))
+			Expect(readTarget(".gitconfig")).To(ContainSubstring("other@example.com"))
+		})
+
+		It("Fails on undefined variables", func() {
+			s := step.NewTemplateStep()
+			s.Target = ".gitconfig"
+			s.Source = "gitconfig"
+
+			_, err := s.Execute(executor)
+			Expect(err).Should(HaveOccurred())
+		})
+
+		It("Takes over untracked files that already match", func() {
+			s := step.NewTemplateStep()
+			s.Target = ".gitconfig"
+			s.Source = "gitconfig"
+			s.Variables["email"] = "me@example.com"
+			writeFile(executor.target, ".gitconfig", "email = me@example.com\nos = "+runtime.GOOS+"\n")
+			os.Chmod(executor.GetTargetPath(".gitconfig"), 0o644)
+
+			changes, err := s.Plan(executor)
+			Expect(err).Should(Succeed())
+			Expect(changes).To(HaveLen(0))
+
+			Expect(s.Execute(executor)).To(haveStatus("unchanged"))
+			Expect(executor.tracked).To(HaveKeyWithValue(executor.GetTargetPath(".gitconfig"), step.TrackedFile))
+			Expect(executor.backedUp).To(HaveLen(0))
+		})
+
+		It("Fails on collisions when Force is disabled", func() {
+			s := step.NewTemplateStep()
+			s.Target = ".gitconfig"
+			s.Source = "gitconfig"
+			s.Variables["email"] = "me@example.com"
+			writeFile(executor.target, ".gitconfig", "mine")
+
+			_, err := s.Execute(executor)
+			Expect(err).Should(HaveOccurred())
+			Expect(readTarget(".gitconfig")).To(Equal("mine"))
+		})
+
+		It("Handles collisions when Force is enabled", func() {
+			s := step.NewTemplateStep()
+			s.Target = ".gitconfig"
+			s.Source = "gitconfig"
+			s.Force = true
+			s.Variables["email"] = "me@example.com"
+			writeFile(executor.target, ".gitconfig", "mine")
+
+			_, err := s.Execute(executor)
+			Expect(err).Should(Succeed())
+			Expect(executor.backedUp).To(HaveLen(1))
+			Expect(readTarget(".gitconfig")).To(ContainSubstring("me@example.com"))
+		})
+	})
+
+	Describe("Uninstall", func() {
+		It("Removes rendered files", func() {
+			executor := NewTestExecutor(tmpdir(), tmpdir())
+			defer rmdir(executor.target)
+			defer rmdir(executor.source)
+			writeFile(executor.source, "gitconfig", "foo")
+
+			s := step.NewTemplateStep()
+			s.Target = ".gitconfig"
+			s.Source = "gitconfig"
+			Expect(s.Execute(executor)).To(haveStatus("created"))
+
+			Expect(s.Uninstall(executor)).Should(Succeed())
+			_, err := os.Stat(executor.GetTargetPath(".gitconfig"))
+			Expect(os.IsNotExist(err)).To(BeTrue())
+			Expect(executor.restored).To(HaveLen(1))
+			Expect(executor.infoLog).To(HaveLen(1))
+		})
+
+		It("Does not report files that are already gone", func() {
+			executor := NewTestExecutor(tmpdir(), tmpdir())
+			defer rmdir(executor.target)
+			defer rmdir(executor.source)
+			writeFile(executor.source, "gitconfig", "foo")
+
+			s := step.NewTemplateStep()
+			s.Target = ".gitconfig"
+			s.Source = "gitconfig"
+			Expect(s.Execute(executor)).To(haveStatus("created"))
+			rm(executor.target, ".gitconfig")
+
+			Expect(s.Uninstall(executor)).Should(Succeed())
+			Expect(executor.infoLog).To(HaveLen(0))
+			Expect(executor.tracked).To(HaveLen(0))
+		})
+	})
+})
@@ -1,8 +1,106 @@
 package step
 
-import "os"
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+)
 
 // IsSymLink indicates whether or not the speicifed FileInfo describes a Symlink
 func IsSymLink(fileInfo os.FileInfo) bool {
 	return fileInfo.Mode()&os.ModeSymlink != 0
 }
+
+// IsWithin indicates whether or not the specified path is located inside of the specified directory
+func IsWithin(path string, directory string) bool {
+	rel, err := filepath.Rel(filepath.Clean(directory), filepath.Clean(path))
+	if err != nil {
+		return false
+	}
+	return rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator))
+}
+
+// Checksum returns the SHA-256 digest of the contents of the specified file
+func Checksum(path string) (string, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer file.Close()
+
+	hash := sha256.New()
+	_, err = io.Copy(hash, file)
+	if err != nil {
+		return "", err
+	}
+
+	return hex.EncodeToString(hash.Sum(nil)), nil
+}
+
+// CopyPath copies the specified file, symlink, or directory tree to the
+// destination, preserving file modes
+func CopyPath(source string, destination string) error {
+	fileInfo, err := os.Lstat(source)
+	if err != nil {
+		return err
+	}
+
+	if IsSymLink(fileInfo) {
+		link, err := os.Readlink(source)
+		if err != nil {
+			return err
+		}
+		return os.Symlink(link, destination)
+
+	} else if fileInfo.IsDir() {
+		err = os.Mkdir(destination, fileInfo.Mode().Perm())
+		if err != nil {
+			return err
+		}
+		children, err := ioutil.ReadDir(source)
+		if err != nil {
+			return err
+		}
+		for _, child := range children {
+			err = CopyPath(
+				filepath.Join(source, child.Name()),
+				filepath.Join(destination, child.Name()),
+			)
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	return copyFile(source, destination, fileInfo.Mode().Perm())
+}
+
+func copyFile(source string, destination string, mode os.FileMode) error {
+	in, err := os.Open(source)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	out, err := os.OpenFile(destination, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, mode)
+	if err != nil {
+		return err
+	}
+
+	_, err = io.Copy(out, in)
+	if err != nil {
+		out.Close()
+		return err
+	}
+	err = out.Close()
+	if err != nil {
+		return err
+	}
+
+	return os.Chmod(destination, mode)
+}
@@ -1,6 +1,7 @@
 package step_test
 
 import (
+	"io/ioutil"
 	"os"
 	"path/filepath"
 
@@ -34,4 +35,49 @@ var _ = Describe("util", func() {
 			Expect(step.IsSymLink(fileInfo)).To(BeFalse())
 		})
 	})
+
+	Describe("IsWithin", func() {
+		It("Works", func() {
+			Expect(step.IsWithin("/foo/bar", "/foo")).To(BeTrue())
+			Expect(step.IsWithin("/foo/bar/baz", "/foo")).To(BeTrue())
+			Expect(step.IsWithin("/foo/../foo/bar", "/foo")).To(BeTrue())
+			Expect(step.IsWithin("/foo", "/foo")).To(BeTrue())
+			Expect(step.IsWithin("/foobar", "/foo")).To(BeFalse())
+			Expect(step.IsWithin("/bar", "/foo")).To(BeFalse())
+			Expect(step.IsWithin("/foo/../bar", "/foo")).To(BeFalse())
+		})
+	})
+
+	Describe("CopyPath", func() {
+		It("Copies files", func() {
+			writeFile(testDir, "foo", "foo")
+			os.Chmod(filepath.Join(testDir, "foo"), 0o600)
+
+			err := step.CopyPath(filepath.Join(testDir, "foo"), filepath.Join(testDir, "bar"))
+			Expect(err).To(Succeed())
+
+			content, err := ioutil.ReadFile(filepath.Join(testDir, "bar"))
+			Expect(err).To(Succeed())
+			Expect(string(content)).To(Equal("foo"))
+			fileInfo, err := os.Stat(filepath.Join(testDir, "bar"))
+			Expect(err).To(Succeed())
+			Expect(fileInfo.Mode().Perm()).To(Equal(os.FileMode(0o600)))
+		})
+
+		It("Copies directory trees", func() {
+			mkdir(testDir, "foo", "sub")
+			writeFile(testDir, "foo/sub/file", "file")
+			ln(filepath.Join(testDir, "foo", "link"), "sub/file")
+
+			err := step.CopyPath(filepath.Join(testDir, "foo"), filepath.Join(testDir, "bar"))
+			Expect(err).To(Succeed())
+
+			content, err := ioutil.ReadFile(filepath.Join(testDir, "bar", "sub", "file"))
+			Expect(err).To(Succeed())
+			Expect(string(content)).To(Equal("file"))
+			link, err := os.Readlink(filepath.Join(testDir, "bar", "link"))
+			Expect(err).To(Succeed())
+			Expect(link).To(Equal("sub/file"))
+		})
+	})
 })
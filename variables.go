@@ -0,0 +1,145 @@
+package dotter
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"os/user"
+	"path/filepath"
+	"regexp"
+	"runtime"
+	"strings"
+	"text/template"
+
+	yaml "gopkg.in/yaml.v3"
+)
+
+// NewBuiltinVariables returns the variables that are always available for
+// interpolation into the configuration
+func NewBuiltinVariables() map[string]string {
+	vars := make(map[string]string)
+
+	vars["os"] = runtime.GOOS
+	vars["arch"] = runtime.GOARCH
+	vars["hostname"], _ = os.Hostname()
+	if current, err := user.Current(); err == nil {
+		vars["user"] = current.Username
+	}
+
+	home, _ := os.UserHomeDir()
+	vars["home"] = home
+	vars["xdg_config_home"] = getXdgDir("XDG_CONFIG_HOME", home, ".config")
+	vars["xdg_data_home"] = getXdgDir("XDG_DATA_HOME", home, ".local", "share")
+	vars["xdg_state_home"] = getXdgDir("XDG_STATE_HOME", home, ".local", "state")
+	vars["xdg_cache_home"] = getXdgDir("XDG_CACHE_HOME", home, ".cache")
+
+	return vars
+}
+
+func getXdgDir(envName string, home string, defaultParts ...string) string {
+	if dir := os.Getenv(envName); dir != "" {
+		return dir
+	}
+	return filepath.Join(append([]string{home}, defaultParts...)...)
+}
+
+// newVariableScope assembles the values available for interpolation; the
+// environment is overridden by the built-ins, which are overridden by the
+// configuration's variables section, which is overridden by the explicit
+// variables (usually from the command line)
+func newVariableScope(variablesNode yaml.Node, explicit map[string]string) (map[string]string, map[string]string, error) {
+	scope := make(map[string]string)
+	for _, pair := range os.Environ() {
+		parts := strings.SplitN(pair, "=", 2)
+		scope[parts[0]] = parts[1]
+	}
+	for name, value := range NewBuiltinVariables() {
+		scope[name] = value
+	}
+
+	// User-defined variables are what is made available to templates
+	defined := make(map[string]string)
+
+	if variablesNode.Kind == yaml.MappingNode {
+		nodes := variablesNode.Content
+		for i := 0; i < len(nodes); i += 2 {
+			value, err := interpolate(nodes[i+1].Value, nodes[i+1].Line, scope)
+			if err != nil {
+				return nil, nil, err
+			}
+			scope[nodes[i].Value] = value
+			defined[nodes[i].Value] = value
+		}
+	} else if variablesNode.Kind != 0 {
+		return nil, nil, fmt.Errorf("Variables not in a mapping at line %d", variablesNode.Line)
+	}
+
+	for name, value := range explicit {
+		scope[name] = value
+		defined[name] = value
+	}
+
+	return scope, defined, nil
+}
+
+var variablePattern = regexp.MustCompile(`\$\$|\$\{([A-Za-z_][A-Za-z0-9_]*)\}`)
+
+// interpolate expands ${name} and {{ .name }} references in the value, the
+// same way in paths, commands and file contents; $$ produces a literal $, and
+// {{ "{{" }} a literal {{
+func interpolate(value string, line int, scope map[string]string) (string, error) {
+	var err error
+
+	expanded := variablePattern.ReplaceAllStringFunc(value, func(match string) string {
+		if match == "$$" {
+			return "$"
+		}
+		name := match[2 : len(match)-1]
+		replacement, ok := scope[name]
+		if !ok && err == nil {
+			err = fmt.Errorf("Undefined variable \"%s\" at line %d", name, line)
+		}
+		return replacement
+	})
+	if err != nil {
+		return "", err
+	}
+
+	if !strings.Contains(expanded, "{{") {
+		return expanded, nil
+	}
+
+	tmpl, err := template.New("").Option("missingkey=error").Parse(expanded)
+	if err != nil {
+		return "", fmt.Errorf("Could not parse \"%s\" at line %d: %w", value, line, err)
+	}
+	var rendered bytes.Buffer
+	err = tmpl.Execute(&rendered, scope)
+	if err != nil {
+		return "", fmt.Errorf("Could not expand \"%s\" at line %d: %w", value, line, err)
+	}
+
+	return rendered.String(), nil
+}
+
+// interpolateNode expands variable references in all of the string values
+// (and mapping keys) within the node
+func interpolateNode(node *yaml.Node, scope map[string]string) error {
+	if node.Kind == yaml.ScalarNode && node.Tag == "!!str" {
+		value, err := interpolate(node.Value, node.Line, scope)
+		if err != nil {
+			return err
+		}
+		node.Value = value
+		return nil
+	}
+
+	for _, child := range node.Content {
+		err := interpolateNode(child, scope)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}